@@ -1,18 +1,17 @@
 package main
 
 import (
-	"fmt"
-	"log"
 	"net/http"
 	"net/http/httptest"
 
 	"github.com/go-laeo/pi"
+	"github.com/go-laeo/pi/pico"
 )
 
 func main() {
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest(http.MethodGet, "/", nil)
-	process().Connect(logging, cors).ServeHTTP(w, r)
+	process().Connect(pico.Logger(pico.LoggerOptions{}), cors).ServeHTTP(w, r)
 	if w.Body.String() != "hello, world!" {
 		panic("unexpected response body!")
 	}
@@ -32,15 +31,6 @@ func process() pi.HandlerFunc {
 	}
 }
 
-func logging(next pi.HandlerFunc) pi.HandlerFunc {
-	return func(ctx pi.Context) error {
-		log.SetPrefix(fmt.Sprintf("[%s] ", ctx.IP()))
-		log.Println(ctx.Method(), ctx.URL().Path)
-
-		return next(ctx)
-	}
-}
-
 func cors(next pi.HandlerFunc) pi.HandlerFunc {
 	return func(ctx pi.Context) error {
 		ctx.Header().Set("Access-Control-Allow-Origin", "*")
@@ -50,8 +40,7 @@ func cors(next pi.HandlerFunc) pi.HandlerFunc {
 			ctx.Header().Set("Access-Control-Methods", "POST, PUT, PATCH, DELETE")
 			ctx.Header().Set("Access-Control-Allow-Headers", "*")
 			ctx.Header().Set("Access-Control-Max-Age", "86400")
-			ctx.WriteHeader(http.StatusNoContent)
-			return nil
+			return ctx.Code(http.StatusNoContent)
 		}
 
 		return next(ctx)
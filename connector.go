@@ -6,3 +6,19 @@ func (h HandlerFunc) Connect(cc ...func(next HandlerFunc) HandlerFunc) HandlerFu
 	}
 	return h
 }
+
+// scope is the middleware stack of a group, a new scope is created by
+// each (ServerMux).Use() of the group and inherited by its children, so
+// the routes registered in the same scope have the same middleware.
+type scope struct {
+	cc []func(next HandlerFunc) HandlerFunc
+}
+
+// middleware returns the middleware of s, s can be nil for the groups
+// without middleware.
+func (s *scope) middleware() []func(next HandlerFunc) HandlerFunc {
+	if s == nil {
+		return nil
+	}
+	return s.cc
+}
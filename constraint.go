@@ -0,0 +1,123 @@
+package pi
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Constraint reports whether value is acceptable by a path param, eg.
+// the "int" constraint in /users/:id<int> only accepts digits.
+type Constraint func(value string) bool
+
+var defaultConstraints = map[string]Constraint{
+	"int":   isInt,
+	"uint":  isUint,
+	"uuid":  isUUID,
+	"alpha": isAlpha,
+	"alnum": isAlnum,
+}
+
+// parseConstraint resolves expr to the named constraint in named, if no
+// such constraint then expr is treated as regular expression which must
+// match the whole param. A bare identifier must be a named constraint,
+// eg. <slug> is rejected if slug is not registered by SetConstraint().
+func parseConstraint(named map[string]Constraint, expr string) (Constraint, error) {
+	if c, ok := named[expr]; ok {
+		return c, nil
+	}
+	if c, ok := defaultConstraints[expr]; ok {
+		return c, nil
+	}
+	if isIdentifier(expr) {
+		return nil, fmt.Errorf("pi: unknown constraint <%s>, it should be registered by SetConstraint() before use", expr)
+	}
+
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("pi: invalid constraint <%s>: %w", expr, err)
+	}
+	return re.MatchString, nil
+}
+
+func isInt(v string) bool {
+	if len(v) > 1 && (v[0] == '-' || v[0] == '+') {
+		v = v[1:]
+	}
+	return isUint(v)
+}
+
+func isUint(v string) bool {
+	if len(v) == 0 {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		if v[i] < '0' || v[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isUUID(v string) bool {
+	if len(v) != 36 {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if v[i] != '-' {
+				return false
+			}
+		default:
+			if !isHex(v[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isAlpha(v string) bool {
+	if len(v) == 0 {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		if !isLetter(v[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlnum(v string) bool {
+	if len(v) == 0 {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		if !isLetter(v[i]) && (v[i] < '0' || v[i] > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// isIdentifier reports whether v is like a name, eg. slug or user_id.
+func isIdentifier(v string) bool {
+	if len(v) == 0 || (!isLetter(v[0]) && v[0] != '_') {
+		return false
+	}
+	for i := 1; i < len(v); i++ {
+		if !isLetter(v[i]) && v[i] != '_' && (v[i] < '0' || v[i] > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func isLetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+func isHex(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+}
@@ -0,0 +1,139 @@
+package pi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServerMux_Constraint(t *testing.T) {
+	gen := func(b string, params ...string) HandlerFunc {
+		return func(ctx Context) error {
+			for _, p := range params {
+				b += " " + ctx.Param(p)
+			}
+			return ctx.Text(b)
+		}
+	}
+
+	sm := NewServerMux()
+	sm.SetConstraint("lower", func(v string) bool {
+		return v == strings.ToLower(v)
+	})
+	sm.Route("/users/me").Get(gen("me"))
+	sm.Route("/users/:id<int>").Get(gen("id", "id"))
+	sm.Route("/users/:uuid<uuid>").Get(gen("uuid", "uuid"))
+	sm.Route("/users/:name").Get(gen("name", "name"))
+	sm.Route("/posts/:slug<[a-z0-9-]+>").Get(gen("slug", "slug"))
+	sm.Route("/tags/:tag<lower>/posts").Get(gen("tag", "tag"))
+	sm.Route("/tags/:tag/*rest").Get(gen("rest", "tag", "rest"))
+
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{
+			name:   "static route should go first",
+			target: "/users/me",
+			want:   "me",
+		},
+		{
+			name:   "int constraint should succeed",
+			target: "/users/100",
+			want:   "id 100",
+		},
+		{
+			name:   "uuid constraint should succeed",
+			target: "/users/7d444840-9dc0-11d1-b245-5ffdce74fad2",
+			want:   "uuid 7d444840-9dc0-11d1-b245-5ffdce74fad2",
+		},
+		{
+			name:   "failed constraint should fall through to unconstrained route",
+			target: "/users/alice",
+			want:   "name alice",
+		},
+		{
+			name:   "regular expression constraint should succeed",
+			target: "/posts/hello-world-2",
+			want:   "slug hello-world-2",
+		},
+		{
+			name:   "custom constraint should succeed",
+			target: "/tags/go/posts",
+			want:   "tag go",
+		},
+		{
+			name:   "failed custom constraint should fall through to wildcard route",
+			target: "/tags/Go/posts",
+			want:   "rest Go posts",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			sm.ServeHTTP(w, r)
+			if w.Body.String() != tt.want {
+				t.Fatalf("body want = %s, got = %s", tt.want, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("failed regular expression constraint should respond 404", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/posts/Hello_World", nil)
+		sm.ServeHTTP(w, r)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("status want = 404, got = %d", w.Code)
+		}
+	})
+
+	t.Run("invalid constraint should panic", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("register invalid constraint should panic")
+			}
+		}()
+		sm.Route("/invalid/:id<[a-z>").Get(gen("invalid"))
+	})
+
+	t.Run("unknown named constraint should panic", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("register unknown named constraint should panic")
+			}
+		}()
+		sm.Route("/unknown/:id<slug>").Get(gen("unknown"))
+	})
+}
+
+func TestDefaultConstraints(t *testing.T) {
+	tests := []struct {
+		expr  string
+		value string
+		want  bool
+	}{
+		{"int", "-12", true},
+		{"int", "-", false},
+		{"int", "1a", false},
+		{"uint", "12", true},
+		{"uint", "-12", false},
+		{"uuid", "7D444840-9DC0-11D1-B245-5FFDCE74FAD2", true},
+		{"uuid", "7d4448409dc011d1b2455ffdce74fad2", false},
+		{"alpha", "abcXYZ", true},
+		{"alpha", "abc1", false},
+		{"alnum", "abc1", true},
+		{"alnum", "", false},
+	}
+	for _, tt := range tests {
+		c, err := parseConstraint(nil, tt.expr)
+		if err != nil {
+			t.Fatalf("parse <%s> got error = %v", tt.expr, err)
+		}
+		if got := c(tt.value); got != tt.want {
+			t.Fatalf("<%s> on %q want = %v, got = %v", tt.expr, tt.value, tt.want, got)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 )
 
 type Context interface {
@@ -38,20 +39,54 @@ type Context interface {
 	Get(name string) string
 
 	// Domain gets domain name of from request's Host field, eg. www.google.com.
+	// The original host forwarded by trusted proxies is used if available,
+	// see WithTrustedProxies().
 	Domain() string
 
+	// Scheme gets the scheme of request, eg. https, the original scheme
+	// forwarded by trusted proxies is used if available.
+	Scheme() string
+
 	URL() *url.URL
 
+	// QueryInt parses query field as int, the first of defaults or zero is
+	// returned if the field does not exist. The returned error responds 400
+	// if the field is not an integer.
+	QueryInt(field string, defaults ...int) (int, error)
+
+	// QueryBool is like QueryInt but parses query field as bool, eg. 1, t, true.
+	QueryBool(field string, defaults ...bool) (bool, error)
+
 	// Param gets named route param by name, returns empty string if it does not exists.
 	Param(name string) string
 
-	// ParamValues returns all path params.
+	// ParamInt parses named route param as int, the returned error responds
+	// 400 if the param does not exist or is not an integer.
+	ParamInt(name string) (int, error)
+
+	// ParamInt64 is like ParamInt but parses named route param as int64.
+	ParamInt64(name string) (int64, error)
+
+	// ParamUUID is like ParamInt but checks named route param is an UUID,
+	// eg. 6ba7b810-9dad-11d1-80b4-00c04fd430c8.
+	ParamUUID(name string) (string, error)
+
+	// ParamBool is like ParamInt but parses named route param as bool.
+	ParamBool(name string) (bool, error)
+
+	// Params returns all route params in order, they are reused after
+	// the request is served, so copy them if they are kept.
+	Params() Params
+
+	// ParamValues returns all route params as url.Values.
 	ParamValues() url.Values
 
-	// IP gets first client IP.
+	// IP gets the client IP, it is the remote address of request unless
+	// the request is forwarded by trusted proxies, see WithTrustedProxies().
 	IP() string
 
-	// IPSet gets all client IPs if available.
+	// IPSet gets the client IP and the IPs of trusted proxies it passed
+	// through, in order from the client to the nearest proxy.
 	IPSet() []string
 
 	Method() string
@@ -114,22 +149,78 @@ type Context interface {
 	SetCookie(c *http.Cookie)
 
 	Error(status int, result *ErrorResult) error
+
+	// Status returns the HTTP status code sent to client, or 0 if nothing
+	// has been sent yet.
+	Status() int
+
+	// Written reports whether the response header has been sent.
+	Written() bool
+
+	// Size returns the number of body bytes written to client.
+	Size() int64
+
+	// Pattern returns the pattern of matched route, eg. /users/:id, or
+	// empty string if no route matches the request.
+	Pattern() string
 }
 
 var _ Context = (*_ctx)(nil)
 
 type _ctx struct {
-	w http.ResponseWriter
-	r *http.Request
-	p url.Values
+	w       http.ResponseWriter
+	r       *http.Request
+	p       Params
+	rw      *responseWriter // shared with derived contexts, except the ones by withWriter().
+	pattern string
+	proxies *proxies
 }
 
-func createContext(w http.ResponseWriter, r *http.Request, cap url.Values) Context {
+func createContext(w http.ResponseWriter, r *http.Request, ps Params) *_ctx {
+	rw := &responseWriter{ResponseWriter: w}
 	return &_ctx{
-		w: w,
-		r: r,
-		p: cap,
+		w:  rw,
+		r:  r,
+		p:  ps,
+		rw: rw,
+	}
+}
+
+// deriveContext returns a copy of ctx which uses w and r as the underlying
+// writer and request.
+func deriveContext(ctx Context, w http.ResponseWriter, r *http.Request) Context {
+	if c, ok := ctx.(*_ctx); ok {
+		cc := *c
+		cc.w = w
+		cc.r = r
+		return &cc
 	}
+	cc := createContext(w, r, ctx.Params())
+	cc.pattern = ctx.Pattern()
+	return cc
+}
+
+// WithWriter returns a copy of ctx which writes response to w, eg. the
+// middleware which buffers or compresses response. The Status(), Written()
+// and Size() of the returned Context report what are written to w, and the
+// route params are copied, so it can be used after the request is served.
+func WithWriter(ctx Context, w http.ResponseWriter) Context {
+	cc := withWriter(ctx, w)
+	if c, ok := cc.(*_ctx); ok {
+		c.p = append(Params(nil), c.p...)
+	}
+	return cc
+}
+
+// withWriter is like WithWriter but shares the route params with ctx.
+func withWriter(ctx Context, w http.ResponseWriter) Context {
+	_, r := ctx.Raw()
+	cc := deriveContext(ctx, w, r)
+	if c, ok := cc.(*_ctx); ok {
+		c.rw = &responseWriter{ResponseWriter: w}
+		c.w = c.rw
+	}
+	return cc
 }
 
 func (c *_ctx) Header() http.Header {
@@ -162,6 +253,14 @@ func (c *_ctx) Query(field string, defaults ...string) string {
 	return ""
 }
 
+func (c *_ctx) QueryInt(field string, defaults ...int) (int, error) {
+	return queryAs(c.r.URL.Query(), field, strconv.Atoi, defaults)
+}
+
+func (c *_ctx) QueryBool(field string, defaults ...bool) (bool, error) {
+	return queryAs(c.r.URL.Query(), field, strconv.ParseBool, defaults)
+}
+
 func (c *_ctx) Form(field string, defaults ...string) string {
 	v := c.r.FormValue(field)
 	if v != "" {
@@ -191,9 +290,32 @@ func (c *_ctx) Get(name string) string {
 }
 
 func (c *_ctx) Domain() string {
+	if c.proxies != nil {
+		hops := c.proxies.forwarding(c.r)
+		for i := len(hops) - 1; i >= 0; i-- {
+			if hops[i].host != "" {
+				return hops[i].host
+			}
+		}
+	}
 	return c.r.Host
 }
 
+func (c *_ctx) Scheme() string {
+	if c.proxies != nil {
+		hops := c.proxies.forwarding(c.r)
+		for i := len(hops) - 1; i >= 0; i-- {
+			if hops[i].proto == "http" || hops[i].proto == "https" {
+				return hops[i].proto
+			}
+		}
+	}
+	if c.r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
 func (c *_ctx) URL() *url.URL {
 	return c.r.URL
 }
@@ -202,11 +324,36 @@ func (c *_ctx) Param(name string) string {
 	return c.p.Get(name)
 }
 
-func (c *_ctx) ParamValues() url.Values {
+func (c *_ctx) ParamInt(name string) (int, error) {
+	return paramAs(c.p, name, strconv.Atoi)
+}
+
+func (c *_ctx) ParamInt64(name string) (int64, error) {
+	return paramAs(c.p, name, parseInt64)
+}
+
+func (c *_ctx) ParamUUID(name string) (string, error) {
+	return paramAs(c.p, name, parseUUID)
+}
+
+func (c *_ctx) ParamBool(name string) (bool, error) {
+	return paramAs(c.p, name, strconv.ParseBool)
+}
+
+func (c *_ctx) Params() Params {
 	return c.p
 }
 
+func (c *_ctx) ParamValues() url.Values {
+	return c.p.Values()
+}
+
 func (c *_ctx) IP() string {
+	if c.proxies != nil {
+		if hops := c.proxies.forwarding(c.r); hops[len(hops)-1].addr.IsValid() {
+			return hops[len(hops)-1].addr.String()
+		}
+	}
 	host, _, err := net.SplitHostPort(c.r.RemoteAddr)
 	if err != nil {
 		return ""
@@ -215,6 +362,16 @@ func (c *_ctx) IP() string {
 }
 
 func (c *_ctx) IPSet() []string {
+	if c.proxies != nil {
+		hops := c.proxies.forwarding(c.r)
+		if hops[0].addr.IsValid() {
+			ips := make([]string, len(hops))
+			for i, h := range hops {
+				ips[len(hops)-1-i] = h.addr.String()
+			}
+			return ips
+		}
+	}
 	host, _, err := net.SplitHostPort(c.r.RemoteAddr)
 	if err != nil {
 		return nil
@@ -266,3 +423,19 @@ func (c *_ctx) Error(status int, result *ErrorResult) error {
 	c.w.WriteHeader(status)
 	return c.Json(result)
 }
+
+func (c *_ctx) Status() int {
+	return c.rw.status
+}
+
+func (c *_ctx) Written() bool {
+	return c.rw.status != 0
+}
+
+func (c *_ctx) Size() int64 {
+	return c.rw.size
+}
+
+func (c *_ctx) Pattern() string {
+	return c.pattern
+}
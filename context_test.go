@@ -2,8 +2,11 @@ package pi
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -22,3 +25,79 @@ func Test_ctx_WithContext(t *testing.T) {
 		c.Context().Value(_a)
 	})
 }
+
+func Test_ctx_TypedParams(t *testing.T) {
+	sm := NewServerMux()
+	sm.Route("/users/:id/:flag").Get(func(ctx Context) error {
+		id, err := ctx.ParamInt64("id")
+		if err != nil {
+			return err
+		}
+		flag, err := ctx.ParamBool("flag")
+		if err != nil {
+			return err
+		}
+		page, err := ctx.QueryInt("page", 1)
+		if err != nil {
+			return err
+		}
+		return ctx.Text(fmt.Sprintf("%d %v %d", id, flag, page))
+	})
+	sm.Route("/teams/:id").Get(func(ctx Context) error {
+		id, err := ctx.ParamUUID("id")
+		if err != nil {
+			return err
+		}
+		n, err := ctx.ParamInt("missing")
+		if err != nil {
+			return err
+		}
+		return ctx.Text(fmt.Sprintf("%s %d", id, n))
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		want   string
+	}{
+		{"typed params should be parsed", "/users/10/true?page=3", 200, "10 true 3"},
+		{"missing query should fallback to default", "/users/10/0", 200, "10 false 1"},
+		{"invalid int param should respond 400", "/users/x/true", 400, `"invalid_param"`},
+		{"invalid bool param should respond 400", "/users/1/yes", 400, `"invalid_param"`},
+		{"invalid query should respond 400", "/users/1/true?page=x", 400, `"invalid_query"`},
+		{"invalid uuid param should respond 400", "/teams/abc", 400, `"invalid_param"`},
+		{"missing param should respond 400", "/teams/6ba7b810-9dad-11d1-80b4-00c04fd430c8", 400, `"missing"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			sm.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.status {
+				t.Fatalf("want status = %d, got = %d", tt.status, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Fatalf("want body contains %s, got = %s", tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestParams(t *testing.T) {
+	ps := Params{{"id", "1"}, {"po", "2"}, {"id", "3"}}
+	if got := ps.Get("id"); got != "1" {
+		t.Fatalf("want first id = 1, got = %s", got)
+	}
+	if _, ok := ps.Lookup("rest"); ok {
+		t.Fatal("rest should not exist")
+	}
+	if got := ps.Values()["id"]; len(got) != 2 || got[1] != "3" {
+		t.Fatalf("want all ids in order, got = %v", got)
+	}
+
+	_, err := paramAs(ps, "po", parseUUID)
+	var he *HTTPError
+	if !errors.As(err, &he) || he.Status != http.StatusBadRequest || !errors.Is(err, errInvalidUUID) {
+		t.Fatalf("want 400 error wraps errInvalidUUID, got = %v", err)
+	}
+}
@@ -1,7 +1,139 @@
 package pi
 
-import "errors"
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
 
 var (
-	ErrHandlerNotFound = errors.New("handler not found")
+	ErrHandlerNotFound  = errors.New("handler not found")
+	ErrMethodNotAllowed = errors.New("method not allowed")
+	ErrRouteNotFound    = errors.New("route not found")
+	ErrMissingParam     = errors.New("missing route param")
+
+	ErrDuplicateRoute     = errors.New("duplicate route")
+	ErrMiddlewareMismatch = errors.New("middleware mismatch")
 )
+
+// HTTPError is an error which carries the HTTP status code and the
+// machine readable code that should be sent to client.
+//
+//	return pi.NotFound("user does not exist").WithCode("user_not_found")
+//
+// The default error formatter of ServerMux recognizes HTTPError (even
+// if it is wrapped) and responds with its status and an ErrorResult.
+type HTTPError struct {
+	// Status is the HTTP status code, eg. 400.
+	Status int
+
+	// Code is a machine readable error code, eg. "bad_request".
+	Code string
+
+	// Message is a human readable error message.
+	Message string
+
+	// Details contains optional extra information for client.
+	Details any
+
+	// Err is the underlying cause, it will not be sent to client.
+	Err error
+}
+
+// NewError creates an HTTPError with status and message, the Code field
+// is derived from the status text, eg. 404 becomes "not_found".
+func NewError(status int, message string) *HTTPError {
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	return &HTTPError{
+		Status:  status,
+		Code:    statusCode(status),
+		Message: message,
+	}
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// WithCode sets the machine readable code of e.
+func (e *HTTPError) WithCode(code string) *HTTPError {
+	e.Code = code
+	return e
+}
+
+// WithDetails attaches extra information to e.
+func (e *HTTPError) WithDetails(details any) *HTTPError {
+	e.Details = details
+	return e
+}
+
+// Wrap sets err as the underlying cause of e.
+func (e *HTTPError) Wrap(err error) *HTTPError {
+	e.Err = err
+	return e
+}
+
+func BadRequest(message string) *HTTPError {
+	return NewError(http.StatusBadRequest, message)
+}
+
+func Unauthorized(message string) *HTTPError {
+	return NewError(http.StatusUnauthorized, message)
+}
+
+func Forbidden(message string) *HTTPError {
+	return NewError(http.StatusForbidden, message)
+}
+
+func NotFound(message string) *HTTPError {
+	return NewError(http.StatusNotFound, message)
+}
+
+func MethodNotAllowed(message string) *HTTPError {
+	return NewError(http.StatusMethodNotAllowed, message)
+}
+
+func Conflict(message string) *HTTPError {
+	return NewError(http.StatusConflict, message)
+}
+
+func UnprocessableEntity(message string) *HTTPError {
+	return NewError(http.StatusUnprocessableEntity, message)
+}
+
+func TooManyRequests(message string) *HTTPError {
+	return NewError(http.StatusTooManyRequests, message)
+}
+
+func InternalServerError(message string) *HTTPError {
+	return NewError(http.StatusInternalServerError, message)
+}
+
+func ServiceUnavailable(message string) *HTTPError {
+	return NewError(http.StatusServiceUnavailable, message)
+}
+
+func GatewayTimeout(message string) *HTTPError {
+	return NewError(http.StatusGatewayTimeout, message)
+}
+
+// statusCode converts status text to snake case, eg. "Not Found" to "not_found".
+func statusCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "unknown"
+	}
+	text = strings.ToLower(text)
+	text = strings.ReplaceAll(text, "-", " ")
+	text = strings.ReplaceAll(text, "'", "")
+	return strings.Join(strings.Fields(text), "_")
+}
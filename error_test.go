@@ -0,0 +1,143 @@
+package pi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         *HTTPError
+		wantStatus  int
+		wantCode    string
+		wantMessage string
+	}{
+		{
+			name:        "NewError should derive code from status",
+			err:         NewError(400, "invalid body"),
+			wantStatus:  400,
+			wantCode:    "bad_request",
+			wantMessage: "invalid body",
+		},
+		{
+			name:        "empty message should use status text",
+			err:         NotFound(""),
+			wantStatus:  404,
+			wantCode:    "not_found",
+			wantMessage: "Not Found",
+		},
+		{
+			name:        "WithCode should override code",
+			err:         Conflict("user exists").WithCode("user_exists"),
+			wantStatus:  409,
+			wantCode:    "user_exists",
+			wantMessage: "user exists",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err.Status != tt.wantStatus {
+				t.Fatalf("status want = %d, got = %d", tt.wantStatus, tt.err.Status)
+			}
+			if tt.err.Code != tt.wantCode {
+				t.Fatalf("code want = %s, got = %s", tt.wantCode, tt.err.Code)
+			}
+			if tt.err.Message != tt.wantMessage {
+				t.Fatalf("message want = %s, got = %s", tt.wantMessage, tt.err.Message)
+			}
+		})
+	}
+}
+
+func TestHTTPError_Unwrap(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := fmt.Errorf("query: %w", InternalServerError("database unavailable").Wrap(cause))
+
+	if !errors.Is(err, cause) {
+		t.Fatalf("errors.Is should find the wrapped cause")
+	}
+
+	var he *HTTPError
+	if !errors.As(err, &he) || he.Status != 500 {
+		t.Fatalf("errors.As should find *HTTPError, got = %v", he)
+	}
+}
+
+func TestServerMux_ErrorFormatter(t *testing.T) {
+	sm := NewServerMux()
+	sm.Route("/users/:id").Get(func(ctx Context) error {
+		return NotFound("user does not exist").WithDetails(map[string]string{"id": ctx.Param("id")})
+	})
+	sm.Route("/wrapped").Get(func(ctx Context) error {
+		return fmt.Errorf("wrapped: %w", BadRequest("invalid"))
+	})
+	sm.Route("/unknown").Get(func(ctx Context) error {
+		return errors.New("boom")
+	})
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantError  string
+	}{
+		{
+			name:       "HTTPError should respond with its status",
+			target:     "/users/1",
+			wantStatus: 404,
+			wantError:  "not_found",
+		},
+		{
+			name:       "wrapped HTTPError should respond with its status",
+			target:     "/wrapped",
+			wantStatus: 400,
+			wantError:  "bad_request",
+		},
+		{
+			name:       "plain error should respond with status 500",
+			target:     "/unknown",
+			wantStatus: 500,
+			wantError:  "unknown",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			sm.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status want = %d, got = %d", tt.wantStatus, w.Code)
+			}
+
+			result := &ErrorResult{}
+			if err := json.NewDecoder(w.Body).Decode(result); err != nil {
+				t.Fatalf("decode ErrorResult: %v", err)
+			}
+			if result.Error != tt.wantError {
+				t.Fatalf("error want = %s, got = %s", tt.wantError, result.Error)
+			}
+		})
+	}
+}
+
+func TestServerMux_ErrorFormatterAfterWritten(t *testing.T) {
+	sm := NewServerMux()
+	sm.Route("/partial").Get(func(ctx Context) error {
+		ctx.Text("partial")
+		return BadRequest("invalid")
+	})
+
+	w := httptest.NewRecorder()
+	sm.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/partial", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status want = 200, got = %d", w.Code)
+	}
+	if w.Body.String() != "partial" {
+		t.Fatalf("error result should not be appended to written body, got = %s", w.Body.String())
+	}
+}
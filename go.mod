@@ -1,3 +1,3 @@
 module github.com/go-laeo/pi
 
-go 1.18
+go 1.21
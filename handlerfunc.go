@@ -1,3 +1,49 @@
 package pi
 
+import "net/http"
+
 type HandlerFunc func(ctx Context) error
+
+// ErrorFormatter responds errors returned by a HandlerFunc which is served
+// by its own ServeHTTP method, routes of ServerMux use the formatter set by
+// (ServerMux).SetErrorFormatter() instead.
+var ErrorFormatter = defaultErrorFormatter
+
+var _ http.Handler = HandlerFunc(nil)
+
+// ServeHTTP implements http.Handler, errors returned by h are passed
+// to ErrorFormatter.
+func (h HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := createContext(w, r, nil)
+	if err := h(ctx); err != nil {
+		ErrorFormatter(ctx, err)
+	}
+}
+
+// Wrap converts a standard http.Handler to HandlerFunc, so it can be
+// registered to routes, eg. the handlers from net/http/pprof.
+//
+//	sm.Route("/debug/pprof/*name").Get(pi.Wrap(http.HandlerFunc(pprof.Index)))
+func Wrap(h http.Handler) HandlerFunc {
+	return func(ctx Context) error {
+		h.ServeHTTP(ctx.Raw())
+		return nil
+	}
+}
+
+// WrapMiddleware converts a standard net/http middleware to the form
+// which can be used by (ServerMux).Use() and (HandlerFunc).Connect().
+// The http.ResponseWriter and *http.Request passed to next handler by
+// m are visible to the subsequent handlers.
+func WrapMiddleware(m func(http.Handler) http.Handler) func(next HandlerFunc) HandlerFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx Context) error {
+			var err error
+			h := m(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				err = next(deriveContext(ctx, w, r))
+			}))
+			h.ServeHTTP(ctx.Raw())
+			return err
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package pi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerFunc_ServeHTTP(t *testing.T) {
+	t.Run("serve HandlerFunc should succeed", func(t *testing.T) {
+		var h HandlerFunc = func(ctx Context) error {
+			return ctx.Text("OK")
+		}
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		h.ServeHTTP(w, r)
+		if w.Body.String() != "OK" {
+			t.Fatalf("body want = OK, got = %s", w.Body.String())
+		}
+	})
+
+	t.Run("returned error should be formatted", func(t *testing.T) {
+		var h HandlerFunc = func(ctx Context) error {
+			return BadRequest("invalid")
+		}
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("status want = 400, got = %d", w.Code)
+		}
+	})
+}
+
+func TestWrap(t *testing.T) {
+	sm := NewServerMux()
+	sm.Route("/std").Any(Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(r.Method))
+	})))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/std", nil)
+	sm.ServeHTTP(w, r)
+	if w.Code != http.StatusAccepted || w.Body.String() != http.MethodPut {
+		t.Fatalf("want = 202 PUT, got = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWrapMiddleware(t *testing.T) {
+	type key struct{}
+
+	m := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Std-Middleware", "1")
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), key{}, "value")))
+		})
+	}
+
+	sm := NewServerMux()
+	sm.Use(WrapMiddleware(m))
+	sm.Route("/users/:id").Get(func(ctx Context) error {
+		v, _ := ctx.Context().Value(key{}).(string)
+		return ctx.Text(v + ctx.Param("id"))
+	})
+	sm.Route("/error").Get(func(ctx Context) error {
+		return Conflict("exists")
+	})
+
+	t.Run("request and params should pass through middleware", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		sm.ServeHTTP(w, r)
+		if w.Header().Get("X-Std-Middleware") != "1" {
+			t.Fatalf("header X-Std-Middleware should be set")
+		}
+		if w.Body.String() != "value1" {
+			t.Fatalf("body want = value1, got = %s", w.Body.String())
+		}
+	})
+
+	t.Run("error should pass through middleware", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/error", nil)
+		sm.ServeHTTP(w, r)
+		if w.Code != http.StatusConflict {
+			t.Fatalf("status want = 409, got = %d", w.Code)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package pi
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// headWriter discards response body, but keeps headers and counts the
+// body size for Content-Length.
+type headWriter struct {
+	http.ResponseWriter
+	status  int
+	size    int
+	flushed bool
+}
+
+var _ http.Flusher = (*headWriter)(nil)
+
+func (w *headWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *headWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.size += len(b)
+	return len(b), nil
+}
+
+// Flush marks the header written, the Content-Length is not set for the
+// streaming responses, like the ones of GET requests.
+func (w *headWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.flushed = true
+}
+
+func (w *headWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *headWriter) flush() {
+	if w.status == 0 {
+		return
+	}
+	if w.size > 0 && !w.flushed && w.Header().Get("Content-Length") == "" {
+		w.Header().Set("Content-Length", strconv.Itoa(w.size))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// serveHead calls fn for HEAD request with response body discarded.
+func serveHead(ctx Context, fn HandlerFunc) error {
+	w, _ := ctx.Raw()
+	hw := &headWriter{ResponseWriter: w}
+	err := fn(withWriter(ctx, hw))
+	hw.flush()
+	return err
+}
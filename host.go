@@ -0,0 +1,83 @@
+package pi
+
+import (
+	"net"
+	"strings"
+)
+
+// host is a route tree serves the requests to the hosts matches pattern.
+type host struct {
+	pattern string
+	labels  []string
+	dynamic bool // pattern contains dynamic labels.
+	root    *_route
+}
+
+func createHost(pattern string, main *_route) *host {
+	pattern = strings.ToLower(pattern)
+	h := &host{
+		pattern: pattern,
+		labels:  strings.Split(pattern, "."),
+		root: &_route{
+			main: main,
+			host: pattern,
+		},
+	}
+	for _, l := range h.labels {
+		if isDynamicLabel(l) {
+			h.dynamic = true
+		}
+	}
+	return h
+}
+
+func isDynamicLabel(l string) bool {
+	return len(l) > 1 && l[0] == dynamic
+}
+
+// match reports whether hostname matches h, the dynamic labels of h,
+// eg. :tenant of :tenant.example.com, are appended to ps on success.
+func (h *host) match(hostname string, ps *Params) bool {
+	if !h.dynamic {
+		return strings.EqualFold(h.pattern, hostname)
+	}
+
+	mark := len(*ps)
+	rest := hostname
+	for i, l := range h.labels {
+		label := rest
+		if i < len(h.labels)-1 {
+			j := strings.IndexByte(rest, '.')
+			if j < 0 {
+				ps.truncate(mark)
+				return false
+			}
+			label, rest = rest[:j], rest[j+1:]
+		} else if strings.IndexByte(label, '.') >= 0 {
+			ps.truncate(mark)
+			return false
+		}
+
+		if !isDynamicLabel(l) {
+			if !strings.EqualFold(l, label) {
+				ps.truncate(mark)
+				return false
+			}
+			continue
+		}
+		if label == "" {
+			ps.truncate(mark)
+			return false
+		}
+		ps.add(l[1:], label)
+	}
+	return true
+}
+
+// hostname returns host without port.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
@@ -0,0 +1,145 @@
+package pi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServerMux_Host(t *testing.T) {
+	gen := func(b string, params ...string) HandlerFunc {
+		return func(ctx Context) error {
+			for _, p := range params {
+				b += " " + ctx.Param(p)
+			}
+			return ctx.Text(b)
+		}
+	}
+
+	sm := NewServerMux()
+	sm.Route("/users").Get(gen("default users"))
+	sm.Route("/health").Get(gen("default health"))
+	sm.Host("api.example.com", func(sm ServerMux) {
+		sm.Route("/users").Get(gen("api users"))
+	})
+	sm.Host(":tenant.example.com", func(sm ServerMux) {
+		sm.Route("/users/:id").Get(gen("tenant user", "tenant", "id"))
+	})
+	sm.Group("/admin", nil).Host("admin.example.com", func(sm ServerMux) {
+		sm.Route("/users").Get(gen("admin users"))
+	})
+
+	tests := []struct {
+		name   string
+		host   string
+		target string
+		want   string
+	}{
+		{
+			name:   "exact host should succeed",
+			host:   "api.example.com",
+			target: "/users",
+			want:   "api users",
+		},
+		{
+			name:   "host with port should succeed",
+			host:   "API.example.com:8080",
+			target: "/users",
+			want:   "api users",
+		},
+		{
+			name:   "exact host should fall back to default host",
+			host:   "api.example.com",
+			target: "/health",
+			want:   "default health",
+		},
+		{
+			name:   "dynamic host should capture label",
+			host:   "acme.example.com",
+			target: "/users/1",
+			want:   "tenant user acme 1",
+		},
+		{
+			name:   "dynamic host should fall back to default host",
+			host:   "acme.example.com",
+			target: "/users",
+			want:   "default users",
+		},
+		{
+			name:   "host in group should keep prefix",
+			host:   "admin.example.com",
+			target: "/admin/users",
+			want:   "admin users",
+		},
+		{
+			name:   "unknown host should use default host",
+			host:   "www.example.org",
+			target: "/users",
+			want:   "default users",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			r.Host = tt.host
+			sm.ServeHTTP(w, r)
+			if w.Body.String() != tt.want {
+				t.Fatalf("body want = %s, got = %s", tt.want, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("fallback should not leak captured host labels", func(t *testing.T) {
+		sm.Route("/tenant").Get(gen("default tenant", "tenant"))
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/tenant", nil)
+		r.Host = "acme.example.com"
+		sm.ServeHTTP(w, r)
+		if w.Body.String() != "default tenant " {
+			t.Fatalf("body want = default tenant, got = %s", w.Body.String())
+		}
+	})
+
+	t.Run("exact host should not fall into dynamic host", func(t *testing.T) {
+		sm.Host(":tenant.example.com", func(sm ServerMux) {
+			sm.Route("/").Get(gen("tenant index", "tenant"))
+		})
+		sm.Route("/").Get(gen("default index"))
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = "api.example.com"
+		sm.ServeHTTP(w, r)
+		if w.Body.String() != "default index" {
+			t.Fatalf("body want = default index, got = %s", w.Body.String())
+		}
+	})
+
+	t.Run("mux-level middleware should apply to host routes", func(t *testing.T) {
+		sm.Use(func(next HandlerFunc) HandlerFunc {
+			return func(ctx Context) error {
+				ctx.Header().Set("X-TEST-HEADER", "TEST")
+				return next(ctx)
+			}
+		})
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/users", nil)
+		r.Host = "api.example.com"
+		sm.ServeHTTP(w, r)
+		if v := w.Header().Get("X-TEST-HEADER"); v != "TEST" {
+			t.Fatalf("header X-TEST-HEADER want = TEST, got = %s", v)
+		}
+	})
+
+	t.Run("Routes should contain host", func(t *testing.T) {
+		hosts := map[string]bool{}
+		for _, ri := range sm.Routes() {
+			hosts[ri.Host] = true
+		}
+		for _, h := range []string{"", "api.example.com", ":tenant.example.com", "admin.example.com"} {
+			if !hosts[h] {
+				t.Fatalf("Routes() should contain host %q", h)
+			}
+		}
+	})
+}
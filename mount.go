@@ -0,0 +1,45 @@
+package pi
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// mountParam is the name of wildcard param which captures the rest of
+// path under the prefix of mounted handler.
+const mountParam = "mount"
+
+// mount converts h to the HandlerFunc which serves the request with the
+// rest of path under prefix, the rest is the last param captured by the
+// wildcard if rest is true, otherwise the request is for prefix itself.
+func mount(h http.Handler, rest bool) HandlerFunc {
+	return func(ctx Context) error {
+		w, r := ctx.Raw()
+
+		upath := "/"
+		if ps := ctx.Params(); rest && len(ps) > 0 {
+			upath += ps[len(ps)-1].Value
+		}
+
+		u := *r.URL
+		u.Path = upath
+		u.RawPath = ""
+		if r.URL.RawPath != "" {
+			// keeps the escaped form of rest, eg. %2F should not become /.
+			raw := r.URL.EscapedPath()
+			for i := strings.LastIndexByte(raw, '/'); i >= 0; i = strings.LastIndexByte(raw[:i], '/') {
+				if p, err := url.PathUnescape(raw[i:]); err == nil && p == upath {
+					u.RawPath = raw[i:]
+					break
+				}
+			}
+		}
+
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = &u
+		h.ServeHTTP(w, r2)
+		return nil
+	}
+}
@@ -0,0 +1,63 @@
+package pi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServerMux_Mount(t *testing.T) {
+	users := NewServerMux()
+	users.Route("/").Get(func(ctx Context) error {
+		return ctx.Text("users")
+	})
+	users.Route("/:id").Get(func(ctx Context) error {
+		return ctx.Text("user " + ctx.Param("id"))
+	})
+
+	raw := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.EscapedPath()))
+	})
+
+	sm := NewServerMux()
+	sm.Mount("/users/", users)
+	sm.Group("/tenants/:tenant", func(sm ServerMux) {
+		sm.Use(func(next HandlerFunc) HandlerFunc {
+			return func(ctx Context) error {
+				ctx.Header().Set("x-tenant", ctx.Param("tenant"))
+				return next(ctx)
+			}
+		})
+		sm.Mount("/files", raw)
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		want   string
+		tenant string
+	}{
+		{"prefix should be stripped", "/users/1", 200, "user 1", ""},
+		{"prefix itself should be served as root", "/users", 200, "users", ""},
+		{"prefix with slash should be served as root", "/users/", 200, "users", ""},
+		{"not found of mounted mux", "/users/1/posts", 404, "", ""},
+		{"middleware of group should be applied", "/tenants/a/files/b/c.txt", 200, "/b/c.txt", "a"},
+		{"escaped path should be kept", "/tenants/a/files/b%2Fc.txt", 200, "/b%2Fc.txt", "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			sm.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.status {
+				t.Fatalf("want status = %d, got = %d", tt.status, w.Code)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Fatalf("want body = %s, got = %s", tt.want, w.Body.String())
+			}
+			if got := w.Header().Get("x-tenant"); got != tt.tenant {
+				t.Fatalf("want tenant = %s, got = %s", tt.tenant, got)
+			}
+		})
+	}
+}
@@ -2,19 +2,45 @@ package pi
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
-	"sync"
+	"strings"
 )
 
 var defaultNotFoundHandler HandlerFunc = func(ctx Context) error {
 	return ctx.Code(404)
 }
 
+var defaultMethodNotAllowedHandler HandlerFunc = func(ctx Context) error {
+	return ctx.Code(http.StatusMethodNotAllowed)
+}
+
+var defaultOptionsHandler HandlerFunc = func(ctx Context) error {
+	return ctx.Code(http.StatusNoContent)
+}
+
 var defaultErrorFormatter = func(ctx Context, err error) {
+	if ctx.Written() {
+		// the status is sent already, the error result would corrupt the body.
+		return
+	}
+
+	var he *HTTPError
+	if errors.As(err, &he) {
+		ctx.Error(he.Status, &ErrorResult{
+			Error:        he.Code,
+			ErrorMessage: he.Message,
+			Details:      he.Details,
+			RequestID:    RequestID(ctx),
+		})
+		return
+	}
+
 	ctx.Error(http.StatusInternalServerError, &ErrorResult{
 		Error:        "unknown",
 		ErrorMessage: err.Error(),
+		RequestID:    RequestID(ctx),
 	})
 }
 
@@ -22,34 +48,93 @@ type ServerMux interface {
 	http.Handler
 
 	Route(path string) Route
-	Group(prefix string, fn func(sm ServerMux))
+
+	// Group creates a child ServerMux which registers routes under prefix
+	// with its own middleware, the child is passed to fn and returned.
+	// The middleware applied by the child's Use() only affect the routes
+	// registered by the child and its descendants.
+	Group(prefix string, fn func(sm ServerMux)) ServerMux
+
+	// Host creates a child ServerMux which registers routes only serve the
+	// requests to the hosts matches pattern, the child is passed to fn and
+	// returned. The pattern can contains dynamic labels which are captured
+	// as route params, eg. :tenant.example.com. Exact hosts are matched
+	// before dynamic ones and only the first matched host is used, if no
+	// route of the host matches the request, the routes of default host
+	// are searched.
+	Host(pattern string, fn func(sm ServerMux)) ServerMux
 	SetNotFoundHandler(h HandlerFunc)
+
+	// SetMethodNotAllowedHandler sets the handler which is called when the
+	// requested path matches a route but the method does not, the Allow
+	// header is already set when h gets called.
+	SetMethodNotAllowedHandler(h HandlerFunc)
 	SetErrorFormatter(fn func(ctx Context, err error))
+
+	// Use applies middleware to all routes of the ServerMux, including the
+	// ones registered before calling Use. The requests do not match any
+	// route, or are redirected by the path policy, are not passed to the
+	// middleware.
 	Use(c func(next HandlerFunc) HandlerFunc)
+
+	// Mount registers h to serve all requests under prefix, the prefix is
+	// stripped from the request path and the rest is passed to h, eg. the
+	// ServerMux of other packages can be mounted to the main one.
+	//
+	//	sm.Mount("/users", users.NewServerMux())
+	//
+	// The middleware of the ServerMux are applied before calling h.
+	Mount(prefix string, h http.Handler)
+
+	// SetConstraint registers constraint c by name, then it can be used by
+	// the routes registered afterwards, eg. /users/:id<name>.
+	SetConstraint(name string, c Constraint)
+
+	// URL generates path of the route named by name, params are pairs of
+	// param name and value, eg. sm.URL("user.posts", "id", "1", "rest", "a/b").
+	URL(name string, params ...string) (string, error)
+
+	// URLValues generates path of the route named by name with params.
+	URLValues(name string, params url.Values) (string, error)
+
+	// Routes returns all registered routes in tree order, see Walk().
+	Routes() []RouteInfo
+
+	// Walk calls fn for each registered route in tree order: the routes of
+	// default host first, then the routes of each host, and in each tree
+	// the static children sorted by segment, then params and wildcard, eg.
+	// /a/b is before /a/:id. It stops at the first error returned by fn
+	// and returns that error.
+	Walk(fn func(RouteInfo) error) error
 }
 
 var _ ServerMux = (*servermux)(nil)
 
 type servermux struct {
-	notFoundHandler HandlerFunc
-	root            *_route
-	capcap          *sync.Pool
-	errorFormater   func(ctx Context, err error)
-	prefix          string
-	cc              []func(next HandlerFunc) HandlerFunc
+	notFoundHandler         HandlerFunc
+	methodNotAllowedHandler HandlerFunc
+	root                    *_route
+	hosts                   []*host
+	policy                  PathPolicy
+	fold                    bool
+	escaped                 bool
+	proxies                 proxies
+	errorFormater           func(ctx Context, err error)
 }
 
-func NewServerMux() ServerMux {
-	return &servermux{
-		root:            createRootRoute(),
-		notFoundHandler: defaultNotFoundHandler,
-		errorFormater:   defaultErrorFormatter,
-		capcap: &sync.Pool{
-			New: func() any {
-				return make(url.Values)
-			},
-		},
+func NewServerMux(opts ...Option) ServerMux {
+	sm := &servermux{
+		root:                    createRootRoute(),
+		notFoundHandler:         defaultNotFoundHandler,
+		methodNotAllowedHandler: defaultMethodNotAllowedHandler,
+		errorFormater:           defaultErrorFormatter,
+	}
+
+	for _, opt := range opts {
+		opt(sm)
 	}
+
+	return sm
 }
 
 func (sm *servermux) SetErrorFormatter(fn func(ctx Context, err error)) {
@@ -60,28 +145,40 @@ func (sm *servermux) SetNotFoundHandler(h HandlerFunc) {
 	sm.notFoundHandler = h
 }
 
+func (sm *servermux) SetMethodNotAllowedHandler(h HandlerFunc) {
+	sm.methodNotAllowedHandler = h
+}
+
 func (sm *servermux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	cap := sm.capcap.Get().(url.Values)
-	defer func() {
-		for k := range cap {
-			cap[k] = cap[k][:0] // reset slice to empty, but the keys in map will keep
-		}
-		sm.capcap.Put(cap)
-	}()
+	ps := paramsPool.Get().(*Params)
+	defer paramsPool.Put(ps)
+
+	ps.truncate(0)
+	n, to := sm.match(r, ps)
 
-	ctx := createContext(w, r, cap)
+	ctx := createContext(w, r, *ps)
+	if len(sm.proxies.prefixes) > 0 {
+		ctx.proxies = &sm.proxies
+	}
+	if n != nil {
+		ctx.pattern = n.full
+	}
 
 	var err error
-	n := sm.root.Search(r.URL.Path, cap) // 1 allocs/op
-	if n == nil {
+	switch {
+	case to != "":
+		err = sm.redirect(ctx, to)
+	case n == nil:
 		err = ErrHandlerNotFound
-	} else {
-		// 2 allocs/op
+	default:
 		err = n.Invoke(ctx)
 	}
 
-	if errors.Is(err, ErrHandlerNotFound) {
+	switch {
+	case errors.Is(err, ErrHandlerNotFound):
 		err = sm.notFoundHandler(ctx)
+	case errors.Is(err, ErrMethodNotAllowed):
+		err = sm.methodNotAllowedHandler(ctx)
 	}
 
 	if err != nil {
@@ -89,19 +186,195 @@ func (sm *servermux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// search finds route by upath for r in the tree of the first matched host,
+// then in the default tree. The other hosts are never searched, eg. the
+// requests to api.example.com are not served by :tenant.example.com.
+func (sm *servermux) search(r *http.Request, upath string, ps *Params) *_route {
+	if len(sm.hosts) > 0 {
+		name := hostname(r.Host)
+		for _, h := range sm.hosts {
+			mark := len(*ps)
+			if !h.match(name, ps) {
+				continue
+			}
+			if n := h.root.lookup(upath, ps); n != nil {
+				return n
+			}
+			ps.truncate(mark)
+			break
+		}
+	}
+
+	return sm.root.lookup(upath, ps)
+}
+
+// searchFold is like search but matches static segments case-insensitively,
+// it returns the matched path in canonical case, or empty string if not found.
+func (sm *servermux) searchFold(r *http.Request, upath string) string {
+	chunks := strings.Split(upath, "/")
+	roots := []*_route{}
+	if len(sm.hosts) > 0 {
+		name := hostname(r.Host)
+		ps := Params{}
+		for _, h := range sm.hosts {
+			if h.match(name, &ps) {
+				roots = append(roots, h.root)
+				break
+			}
+		}
+	}
+	roots = append(roots, sm.root)
+
+	for _, root := range roots {
+		if fixed := root.searchFold(chunks, make([]string, 0, len(chunks))); fixed != nil {
+			return strings.Join(fixed, "/")
+		}
+	}
+	return ""
+}
+
 func (sm *servermux) Route(path string) Route {
-	return sm.root.Insert(sm.prefix+path, sm.cc...)
+	return sm.root.Insert(path)
+}
+
+func (sm *servermux) Group(prefix string, fn func(sm ServerMux)) ServerMux {
+	return (&router{servermux: sm, root: sm.root}).Group(prefix, fn)
+}
+
+func (sm *servermux) Host(pattern string, fn func(sm ServerMux)) ServerMux {
+	return (&router{servermux: sm, root: sm.root}).Host(pattern, fn)
 }
 
-func (sm *servermux) Group(prefix string, fn func(sm ServerMux)) {
-	prev := sm.prefix
-	prevCC := sm.cc
-	sm.prefix = sm.prefix + prefix
-	fn(sm)
-	sm.prefix = prev
-	sm.cc = prevCC
+func (sm *servermux) Mount(prefix string, h http.Handler) {
+	(&router{servermux: sm, root: sm.root}).Mount(prefix, h)
+}
+
+// host finds or creates the host by pattern.
+func (sm *servermux) host(pattern string) *host {
+	sm.root.mu.Lock()
+	defer sm.root.mu.Unlock()
+
+	for _, h := range sm.hosts {
+		if strings.EqualFold(h.pattern, pattern) {
+			return h
+		}
+	}
+
+	h := createHost(pattern, sm.root)
+	// exact hosts should be matched before dynamic ones.
+	i := len(sm.hosts)
+	for !h.dynamic && i > 0 && sm.hosts[i-1].dynamic {
+		i--
+	}
+	sm.hosts = append(sm.hosts, nil)
+	copy(sm.hosts[i+1:], sm.hosts[i:])
+	sm.hosts[i] = h
+	return h
+}
+
+func (sm *servermux) SetConstraint(name string, c Constraint) {
+	sm.root.mu.Lock()
+	defer sm.root.mu.Unlock()
+
+	sm.root.constraints[name] = c
+}
+
+func (sm *servermux) URL(name string, params ...string) (string, error) {
+	v := make(url.Values, len(params)/2)
+	for i := 0; i+1 < len(params); i += 2 {
+		v.Set(params[i], params[i+1])
+	}
+	return sm.URLValues(name, v)
+}
+
+func (sm *servermux) URLValues(name string, params url.Values) (string, error) {
+	r, ok := sm.root.names[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrRouteNotFound, name)
+	}
+	return r.build(params)
+}
+
+func (sm *servermux) Routes() []RouteInfo {
+	var routes []RouteInfo
+	sm.Walk(func(ri RouteInfo) error {
+		routes = append(routes, ri)
+		return nil
+	})
+	return routes
+}
+
+func (sm *servermux) Walk(fn func(RouteInfo) error) error {
+	if err := sm.root.walk(fn); err != nil {
+		return err
+	}
+	for _, h := range sm.hosts {
+		if err := h.root.walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (sm *servermux) Use(c func(next HandlerFunc) HandlerFunc) {
-	sm.cc = append(sm.cc, c)
+	sm.root.mu.Lock()
+	defer sm.root.mu.Unlock()
+
+	sm.root.cc = append(sm.root.cc, c)
+	sm.root.compileAll(sm.root.cc)
+	for _, h := range sm.hosts {
+		h.root.compileAll(sm.root.cc)
+	}
+}
+
+// router is the ServerMux created by (ServerMux).Group(), it registers
+// routes to the underlying servermux with prefix and its own middleware.
+type router struct {
+	*servermux
+	root   *_route
+	prefix string
+	scope  *scope
+}
+
+func (r *router) Route(path string) Route {
+	return r.root.insert(r.prefix+path, r.scope)
+}
+
+func (r *router) Group(prefix string, fn func(sm ServerMux)) ServerMux {
+	child := &router{
+		servermux: r.servermux,
+		root:      r.root,
+		prefix:    r.prefix + prefix,
+		scope:     r.scope,
+	}
+	if fn != nil {
+		fn(child)
+	}
+	return child
+}
+
+func (r *router) Host(pattern string, fn func(sm ServerMux)) ServerMux {
+	child := &router{
+		servermux: r.servermux,
+		root:      r.servermux.host(pattern).root,
+		prefix:    r.prefix,
+		scope:     r.scope,
+	}
+	if fn != nil {
+		fn(child)
+	}
+	return child
+}
+
+func (r *router) Mount(prefix string, h http.Handler) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	r.Route(prefix + "/*" + mountParam).Any(mount(h, true))
+	if prefix != "" {
+		r.Route(prefix).Any(mount(h, false))
+	}
+}
+
+func (r *router) Use(c func(next HandlerFunc) HandlerFunc) {
+	cc := r.scope.middleware()
+	r.scope = &scope{cc: append(cc[:len(cc):len(cc)], c)} // appending must not affect the other scopes.
 }
@@ -2,8 +2,15 @@ package pi
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -228,3 +235,458 @@ func BenchmarkServerMux_ServeHTTP(b *testing.B) {
 		sm.ServeHTTP(w, r)
 	}
 }
+
+func TestServerMux_MethodNotAllowed(t *testing.T) {
+	sm := NewServerMux()
+	sm.Route("/users/:id").Get(func(ctx Context) error {
+		return ctx.Text("OK")
+	}).Put(func(ctx Context) error {
+		return ctx.Text("OK")
+	})
+
+	t.Run("request with unregistered method should got status 405", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodDelete, "/users/1", nil)
+		sm.ServeHTTP(w, r)
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("status want = 405, got = %d", w.Code)
+		}
+		if v := w.Header().Get("Allow"); v != "GET, HEAD, OPTIONS, PUT" {
+			t.Fatalf("header Allow want = GET, HEAD, OPTIONS, PUT, got = %s", v)
+		}
+	})
+
+	t.Run("request unknown path should still got status 404", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodDelete, "/users", nil)
+		sm.ServeHTTP(w, r)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("status want = 404, got = %d", w.Code)
+		}
+	})
+
+	t.Run("custom handler should be called", func(t *testing.T) {
+		sm.SetMethodNotAllowedHandler(func(ctx Context) error {
+			return MethodNotAllowed("allowed: " + ctx.Header().Get("Allow"))
+		})
+		defer sm.SetMethodNotAllowedHandler(defaultMethodNotAllowedHandler)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/users/1", nil)
+		sm.ServeHTTP(w, r)
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("status want = 405, got = %d", w.Code)
+		}
+		if !bytes.Contains(w.Body.Bytes(), []byte("allowed: GET, HEAD, OPTIONS, PUT")) {
+			t.Fatalf("body should contains allowed methods, got = %s", w.Body.String())
+		}
+	})
+}
+
+func TestServerMux_AutoHeadOptions(t *testing.T) {
+	sm := NewServerMux()
+	sm.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx Context) error {
+			ctx.Header().Set("X-TEST-HEADER", "TEST")
+			return next(ctx)
+		}
+	})
+	sm.Route("/users").Get(func(ctx Context) error {
+		ctx.Header().Set("X-Total", "2")
+		return ctx.Text("alice,bob")
+	}).Post(func(ctx Context) error {
+		return ctx.Code(http.StatusCreated)
+	})
+	sm.Route("/preflight").Get(func(ctx Context) error {
+		return ctx.Text("GET")
+	}).Head(func(ctx Context) error {
+		return ctx.Code(http.StatusAccepted)
+	}).Options(func(ctx Context) error {
+		return ctx.Text("OPTIONS")
+	})
+
+	t.Run("HEAD should be answered by GET handler without body", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodHead, "/users", nil)
+		sm.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status want = 200, got = %d", w.Code)
+		}
+		if w.Body.Len() != 0 {
+			t.Fatalf("body should be empty, got = %s", w.Body.String())
+		}
+		if v := w.Header().Get("Content-Length"); v != "9" {
+			t.Fatalf("header Content-Length want = 9, got = %s", v)
+		}
+		if v := w.Header().Get("X-Total"); v != "2" {
+			t.Fatalf("header X-Total want = 2, got = %s", v)
+		}
+	})
+
+	t.Run("HEAD should be answered by streaming GET handler", func(t *testing.T) {
+		sm.Route("/stream").Get(func(ctx Context) error {
+			w, _ := ctx.Raw()
+			ctx.Text("data: 1\n\n")
+			w.(http.Flusher).Flush()
+			return http.NewResponseController(w).Flush()
+		})
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodHead, "/stream", nil)
+		sm.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status want = 200, got = %d", w.Code)
+		}
+		if w.Body.Len() != 0 {
+			t.Fatalf("body should be empty, got = %s", w.Body.String())
+		}
+		if v := w.Header().Get("Content-Length"); v != "" {
+			t.Fatalf("header Content-Length should not be set for streaming response, got = %s", v)
+		}
+	})
+
+	t.Run("HEAD should report status to middleware", func(t *testing.T) {
+		var status int
+		var size int64
+		var written bool
+		sm := NewServerMux()
+		sm.Use(func(next HandlerFunc) HandlerFunc {
+			return func(ctx Context) error {
+				err := next(ctx)
+				status, written, size = ctx.Status(), ctx.Written(), ctx.Size()
+				return err
+			}
+		})
+		sm.Route("/missing").Get(func(ctx Context) error {
+			ctx.Code(http.StatusNotFound)
+			return ctx.Text("missing")
+		})
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodHead, "/missing", nil)
+		sm.ServeHTTP(w, r)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("status want = 404, got = %d", w.Code)
+		}
+		if status != http.StatusNotFound || !written || size != 7 {
+			t.Fatalf("middleware want = 404 true 7, got = %d %v %d", status, written, size)
+		}
+	})
+
+	t.Run("OPTIONS should be answered automatically", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodOptions, "/users", nil)
+		sm.ServeHTTP(w, r)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("status want = 204, got = %d", w.Code)
+		}
+		if v := w.Header().Get("Allow"); v != "GET, HEAD, OPTIONS, POST" {
+			t.Fatalf("header Allow want = GET, HEAD, OPTIONS, POST, got = %s", v)
+		}
+		if v := w.Header().Get("X-TEST-HEADER"); v != "TEST" {
+			t.Fatalf("automatic OPTIONS should run middleware, got X-TEST-HEADER = %s", v)
+		}
+	})
+
+	t.Run("explicit handlers should win", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodHead, "/preflight", nil)
+		sm.ServeHTTP(w, r)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("HEAD status want = 202, got = %d", w.Code)
+		}
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodOptions, "/preflight", nil)
+		sm.ServeHTTP(w, r)
+		if w.Body.String() != "OPTIONS" {
+			t.Fatalf("OPTIONS body want = OPTIONS, got = %s", w.Body.String())
+		}
+	})
+}
+
+func TestServerMux_Routes(t *testing.T) {
+	nop := func(ctx Context) error { return nil }
+	cors := func(next HandlerFunc) HandlerFunc { return next }
+
+	sm := NewServerMux()
+	sm.Route("/users").Get(nop).Post(nop)
+	sm.Route("/users/:id").Get(nop).Delete(nop).Name("user")
+	sm.Group("/api", func(sm ServerMux) {
+		sm.Use(cors)
+		sm.Route("/status").Any(nop)
+	})
+
+	want := []RouteInfo{
+		{Pattern: "/api/status", Methods: []string{"*"}, Middlewares: 1},
+		{Pattern: "/users", Methods: []string{"GET", "POST"}},
+		{Pattern: "/users/:id", Methods: []string{"DELETE", "GET"}, Name: "user"},
+	}
+	if got := sm.Routes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Routes() want = %v, got = %v", want, got)
+	}
+
+	t.Run("Walk should stop at first error", func(t *testing.T) {
+		stop := errors.New("stop")
+		n := 0
+		err := sm.Walk(func(ri RouteInfo) error {
+			n++
+			return stop
+		})
+		if err != stop || n != 1 {
+			t.Fatalf("Walk should return first error, got = %v, called %d times", err, n)
+		}
+	})
+}
+
+func TestServerMux_StrictMode(t *testing.T) {
+	nop := func(ctx Context) error { return nil }
+	auth := func(next HandlerFunc) HandlerFunc { return next }
+	limit := func(n int) func(next HandlerFunc) HandlerFunc {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx Context) error {
+				if n == 0 {
+					return TooManyRequests("")
+				}
+				return next(ctx)
+			}
+		}
+	}
+
+	tests := []struct {
+		name     string
+		register func(sm ServerMux)
+		wantErr  error
+	}{
+		{
+			name: "duplicate method and pattern",
+			register: func(sm ServerMux) {
+				sm.Route("/users").Get(nop)
+				sm.Route("/users/").Get(nop)
+			},
+			wantErr: ErrDuplicateRoute,
+		},
+		{
+			name: "same pattern with different middleware",
+			register: func(sm ServerMux) {
+				sm.Route("/users").Get(nop)
+				sm.Group("", func(sm ServerMux) {
+					sm.Use(auth)
+					sm.Route("/users").Post(nop)
+				})
+			},
+			wantErr: ErrMiddlewareMismatch,
+		},
+		{
+			name: "same pattern with middleware configured differently",
+			register: func(sm ServerMux) {
+				sm.Group("", func(sm ServerMux) {
+					sm.Use(limit(1))
+					sm.Route("/users").Get(nop)
+				})
+				sm.Group("", func(sm ServerMux) {
+					sm.Use(limit(1000))
+					sm.Route("/users").Post(nop)
+				})
+			},
+			wantErr: ErrMiddlewareMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" should panic in strict mode", func(t *testing.T) {
+			defer func() {
+				err, _ := recover().(error)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("panic want = %v, got = %v", tt.wantErr, err)
+				}
+			}()
+			tt.register(NewServerMux(WithStrictMode()))
+		})
+
+		t.Run(tt.name+" should log warning without strict mode", func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			log.SetOutput(buf)
+			defer log.SetOutput(os.Stderr)
+
+			tt.register(NewServerMux())
+			if !strings.Contains(buf.String(), tt.wantErr.Error()) {
+				t.Fatalf("log want contains %q, got = %s", tt.wantErr, buf.String())
+			}
+		})
+	}
+
+	t.Run("same scope should not conflict in strict mode", func(t *testing.T) {
+		defer func() {
+			if err := recover(); err != nil {
+				t.Fatalf("should not panic, got = %v", err)
+			}
+		}()
+		s := &strictServer{}
+		sm := NewServerMux(WithStrictMode())
+		sm.Group("/api", func(sm ServerMux) {
+			sm.Use(s.auth)
+			sm.Route("/users").Get(nop)
+			sm.Route("/users").Post(nop)
+			sm.Group("", nil).Route("/users").Delete(nop)
+		})
+	})
+}
+
+type strictServer struct{}
+
+func (s *strictServer) auth(next HandlerFunc) HandlerFunc { return next }
+
+func TestServerMux_ScopedMiddleware(t *testing.T) {
+	header := func(k, v string) func(next HandlerFunc) HandlerFunc {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx Context) error {
+				ctx.Header().Add(k, v)
+				return next(ctx)
+			}
+		}
+	}
+	ok := func(ctx Context) error { return ctx.Text("OK") }
+
+	sm := NewServerMux()
+	sm.Route("/early").Get(ok)
+	api := sm.Group("/api", nil)
+	api.Use(header("X-Scope", "api"))
+	v1 := api.Group("/v1", func(sm ServerMux) {
+		sm.Use(header("X-Scope", "v1"))
+	})
+	api.Route("/status").Get(ok)
+	v1.Route("/users").Get(ok).Use(header("X-Route", "users"))
+	sm.Use(header("X-Global", "1"))
+
+	tests := []struct {
+		name       string
+		target     string
+		wantScope  []string
+		wantRoute  string
+		wantGlobal string
+	}{
+		{
+			name:       "mux-level middleware should apply to routes registered earlier",
+			target:     "/early",
+			wantGlobal: "1",
+		},
+		{
+			name:       "group middleware should not leak to parent",
+			target:     "/api/status",
+			wantScope:  []string{"api"},
+			wantGlobal: "1",
+		},
+		{
+			name:       "nested group and route middleware should apply in order",
+			target:     "/api/v1/users",
+			wantScope:  []string{"api", "v1"},
+			wantRoute:  "users",
+			wantGlobal: "1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			sm.ServeHTTP(w, r)
+			if got := w.Header().Values("X-Scope"); strings.Join(got, ",") != strings.Join(tt.wantScope, ",") {
+				t.Fatalf("header X-Scope want = %v, got = %v", tt.wantScope, got)
+			}
+			if got := w.Header().Get("X-Route"); got != tt.wantRoute {
+				t.Fatalf("header X-Route want = %s, got = %s", tt.wantRoute, got)
+			}
+			if got := w.Header().Get("X-Global"); got != tt.wantGlobal {
+				t.Fatalf("header X-Global want = %s, got = %s", tt.wantGlobal, got)
+			}
+		})
+	}
+}
+
+func TestServerMux_ConcurrentRegistration(t *testing.T) {
+	sm := NewServerMux()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sm.SetConstraint(fmt.Sprintf("c%d", i), func(v string) bool { return v == fmt.Sprint(i) })
+			sm.Group(fmt.Sprintf("/g%d", i), func(sm ServerMux) {
+				sm.Use(func(next HandlerFunc) HandlerFunc { return next })
+				sm.Route("/users").Get(func(ctx Context) error {
+					return ctx.Text(fmt.Sprint(i))
+				})
+				sm.Route(fmt.Sprintf("/users/:id<c%d>", i)).Get(func(ctx Context) error {
+					return ctx.Text(ctx.Param("id"))
+				})
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	if n := len(sm.Routes()); n != 16 {
+		t.Fatalf("routes want = 16, got = %d", n)
+	}
+	for i := 0; i < 8; i++ {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/g%d/users", i), nil)
+		sm.ServeHTTP(w, r)
+		if w.Body.String() != fmt.Sprint(i) {
+			t.Fatalf("body want = %d, got = %s", i, w.Body.String())
+		}
+	}
+}
+
+func setupLookupBenchmark() (*servermux, map[string]*http.Request) {
+	nop := func(ctx Context) error { return nil }
+	sm := NewServerMux().(*servermux)
+	sm.Route("/").Get(nop)
+	sm.Route("/api/v1/users").Get(nop)
+	sm.Route("/api/v1/users/admin/share").Get(nop)
+	sm.Route("/api/v1/users/:id<int>").Get(nop)
+	sm.Route("/api/v1/users/:id/posts").Get(nop)
+	sm.Route("/api/v1/users/:id/posts/:po").Get(nop)
+	sm.Route("/api/v1/teams/:team/members/:member/roles").Get(nop)
+	sm.Route("/uploads/*path").Get(nop)
+
+	return sm, map[string]*http.Request{
+		"static":    httptest.NewRequest(http.MethodGet, "/api/v1/users/admin/share", nil),
+		"param":     httptest.NewRequest(http.MethodGet, "/api/v1/users/100/posts/101", nil),
+		"backtrack": httptest.NewRequest(http.MethodGet, "/api/v1/users/admin/posts", nil),
+		"wildcard":  httptest.NewRequest(http.MethodGet, "/uploads/users/1.avatar.png", nil),
+	}
+}
+
+func TestServerMux_LookupAllocs(t *testing.T) {
+	sm, requests := setupLookupBenchmark()
+	for name, r := range requests {
+		ps := paramsPool.Get().(*Params)
+		allocs := testing.AllocsPerRun(100, func() {
+			ps.truncate(0)
+			if n, _ := sm.match(r, ps); n == nil {
+				t.Fatalf("%s route should be found", name)
+			}
+		})
+		paramsPool.Put(ps)
+		if allocs != 0 {
+			t.Fatalf("looking up %s route want = 0 allocs/op, got = %v", name, allocs)
+		}
+	}
+}
+
+func BenchmarkServerMux_Lookup(b *testing.B) {
+	sm, requests := setupLookupBenchmark()
+	for _, name := range []string{"static", "param", "backtrack", "wildcard"} {
+		r := requests[name]
+		b.Run(name, func(b *testing.B) {
+			ps := paramsPool.Get().(*Params)
+			defer paramsPool.Put(ps)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ps.truncate(0)
+				sm.match(r, ps)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package pi
+
+// Option configures ServerMux created by NewServerMux().
+type Option func(sm *servermux)
+
+// WithStrictMode makes ServerMux panic on conflicting registrations, such
+// as registering the same method and pattern twice, or registering the
+// same pattern in the groups with different middleware. The groups are
+// considered having the same middleware only if one inherits the other
+// without calling Use(), so the methods of a pattern should be registered
+// in one group. Without strict mode, these conflicts are logged as
+// warnings.
+func WithStrictMode() Option {
+	return func(sm *servermux) {
+		sm.root.strict = true
+	}
+}
+
+// WithPathPolicy sets how ServerMux treats unclean request paths and
+// trailing slashes, the default policy is PathClean.
+func WithPathPolicy(p PathPolicy) Option {
+	return func(sm *servermux) {
+		sm.policy = p
+		sm.root.slash = p != PathClean
+	}
+}
+
+// WithCaseInsensitive makes ServerMux match static path segments case
+// insensitively if no route matches the request exactly, the client is
+// redirected to the path in canonical case, eg. /Users to /users.
+func WithCaseInsensitive() Option {
+	return func(sm *servermux) {
+		sm.fold = true
+	}
+}
+
+// WithEscapedPath makes ServerMux match routes against the escaped request
+// path, eg. /files/a%2Fb/meta matches /files/:name/meta, then each captured
+// param is unescaped individually, so the name param is a/b. The static
+// segments are compared with the unescaped ones, eg. /caf%C3%A9 matches /café.
+func WithEscapedPath() Option {
+	return func(sm *servermux) {
+		sm.escaped = true
+	}
+}
+
+// WithTrustedProxies makes Context accept the client IP, scheme and host
+// forwarded by the proxies in cidrs, eg. 10.0.0.0/8 or 192.168.1.1. The
+// forwarding header, see WithProxyHeader(), is parsed from the right, and
+// stops at the first address which is not trusted. It panics if any of
+// cidrs is invalid.
+func WithTrustedProxies(cidrs ...string) Option {
+	ps, err := parseProxies(cidrs)
+	if err != nil {
+		panic(err)
+	}
+	return func(sm *servermux) {
+		sm.proxies.prefixes = ps
+	}
+}
+
+// WithProxyHeader sets the forwarding header which the trusted proxies
+// set, the default is ProxyXForwardedFor. The other forwarding headers
+// are ignored, as the proxies may pass them through from clients.
+func WithProxyHeader(h ProxyHeader) Option {
+	return func(sm *servermux) {
+		sm.proxies.header = h
+	}
+}
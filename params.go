@@ -0,0 +1,137 @@
+package pi
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Param is a route param captured from the request path or host.
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params are the captured route params in the order of pattern, eg.
+// /users/:id/posts/:po captures [{id 1} {po 2}] from /users/1/posts/2.
+type Params []Param
+
+// paramsPool pools the params for looking up routes, the capacity of
+// pooled params is enough for most routes, so looking up does not
+// allocate memory.
+var paramsPool = sync.Pool{
+	New: func() any {
+		ps := make(Params, 0, 8)
+		return &ps
+	},
+}
+
+// Get gets the first param named by name, returns empty string if it does not exists.
+func (ps Params) Get(name string) string {
+	v, _ := ps.Lookup(name)
+	return v
+}
+
+// Lookup is like Get but reports whether the param exists.
+func (ps Params) Lookup(name string) (string, bool) {
+	for _, p := range ps {
+		if p.Key == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// Values converts ps to url.Values.
+func (ps Params) Values() url.Values {
+	v := make(url.Values, len(ps))
+	for _, p := range ps {
+		v.Add(p.Key, p.Value)
+	}
+	return v
+}
+
+func (ps *Params) add(key, value string) {
+	*ps = append(*ps, Param{Key: key, Value: value})
+}
+
+func (ps *Params) truncate(n int) {
+	*ps = (*ps)[:n]
+}
+
+// unescape unescapes the params which are matched against the escaped
+// path, invalid escapes are kept as they are.
+func (ps Params) unescape() {
+	for i, p := range ps {
+		if strings.IndexByte(p.Value, '%') < 0 {
+			continue
+		}
+		if v, err := url.PathUnescape(p.Value); err == nil {
+			ps[i].Value = v
+		}
+	}
+}
+
+var errInvalidUUID = errors.New("invalid UUID")
+
+func parseUUID(v string) (string, error) {
+	if !isUUID(v) {
+		return "", errInvalidUUID
+	}
+	return v, nil
+}
+
+// invalidParam creates the 400 error for the route param which can not
+// be parsed, it is also used when the param does not exist.
+func invalidParam(name string, err error) *HTTPError {
+	return BadRequest(fmt.Sprintf("invalid route param %q", name)).
+		WithCode("invalid_param").
+		WithDetails(map[string]string{"param": name}).
+		Wrap(err)
+}
+
+// invalidQuery creates the 400 error for the query field which can not be parsed.
+func invalidQuery(field string, err error) *HTTPError {
+	return BadRequest(fmt.Sprintf("invalid query field %q", field)).
+		WithCode("invalid_query").
+		WithDetails(map[string]string{"field": field}).
+		Wrap(err)
+}
+
+// paramAs parses the route param named by name with parse.
+func paramAs[T any](ps Params, name string, parse func(string) (T, error)) (T, error) {
+	var zero T
+	v, ok := ps.Lookup(name)
+	if !ok {
+		return zero, invalidParam(name, ErrMissingParam)
+	}
+	t, err := parse(v)
+	if err != nil {
+		return zero, invalidParam(name, err)
+	}
+	return t, nil
+}
+
+// queryAs parses the query field with parse, the first of defaults or
+// zero value is returned if the field does not exist.
+func queryAs[T any](q url.Values, field string, parse func(string) (T, error), defaults []T) (T, error) {
+	var zero T
+	if !q.Has(field) {
+		if len(defaults) > 0 {
+			return defaults[0], nil
+		}
+		return zero, nil
+	}
+	t, err := parse(q.Get(field))
+	if err != nil {
+		return zero, invalidQuery(field, err)
+	}
+	return t, nil
+}
+
+func parseInt64(v string) (int64, error) {
+	return strconv.ParseInt(v, 10, 64)
+}
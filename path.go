@@ -0,0 +1,160 @@
+package pi
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// PathPolicy decides how ServerMux treats unclean request paths and
+// trailing slashes.
+type PathPolicy int
+
+const (
+	// PathClean cleans request paths and ignores trailing slashes silently,
+	// eg. /users/, /users and //users/../users are the same route. It is
+	// the default policy.
+	PathClean PathPolicy = iota
+
+	// PathRedirect redirects requests with unclean path to the cleaned
+	// one, eg. //users/../users to /users, and redirects requests to the
+	// path with or without trailing slash if only the other one is
+	// registered. Trailing slash is significant under this policy.
+	PathRedirect
+
+	// PathStrict matches request paths as they are, unclean paths will
+	// not be matched and trailing slash is significant.
+	PathStrict
+)
+
+// cleanPath is like path.Clean but keeps the trailing slash.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	c := path.Clean(p)
+	if p[len(p)-1] == '/' && c != "/" {
+		c += "/"
+	}
+	return c
+}
+
+// toggleSlash adds trailing slash to p if it does not have one, otherwise
+// removes the trailing slash.
+func toggleSlash(p string) string {
+	if p == "/" {
+		return ""
+	}
+	if strings.HasSuffix(p, "/") {
+		return p[:len(p)-1]
+	}
+	return p + "/"
+}
+
+// match finds route for r according to the path policy, if r should be
+// redirected to the canonical path, the path is returned instead.
+func (sm *servermux) match(r *http.Request, ps *Params) (*_route, string) {
+	upath := r.URL.Path
+	if sm.escaped {
+		upath = unescapeStatic(r.URL.EscapedPath())
+	}
+
+	switch sm.policy {
+	case PathClean:
+		upath = path.Clean(upath)
+	case PathRedirect:
+		if p := cleanPath(upath); p != upath {
+			return nil, p
+		}
+	}
+
+	if n := sm.search(r, upath, ps); n != nil {
+		if sm.escaped {
+			ps.unescape()
+		}
+		return n, ""
+	}
+
+	if sm.policy == PathRedirect {
+		if p := toggleSlash(upath); p != "" && sm.search(r, p, ps) != nil {
+			ps.truncate(0)
+			return nil, p
+		}
+	}
+
+	if sm.fold {
+		if p := sm.searchFold(r, upath); p != "" && p != upath {
+			return nil, p
+		}
+	}
+
+	return nil, ""
+}
+
+// redirect redirects client to path to permanently, the method of request
+// is kept except for GET and HEAD.
+func (sm *servermux) redirect(ctx Context, to string) error {
+	code := http.StatusPermanentRedirect
+	if ctx.Is(http.MethodGet) || ctx.Is(http.MethodHead) {
+		code = http.StatusMovedPermanently
+	}
+
+	u := *ctx.URL()
+	u.Path = to
+	u.RawPath = ""
+	if sm.escaped {
+		u.Path, _ = url.PathUnescape(to)
+		u.RawPath = escapeSegments(to)
+	}
+	return ctx.Redirect(u.String(), code)
+}
+
+// unescapeStatic unescapes the escaped path p except for the escaped
+// slashes and percent signs, so the static segments can be compared with
+// routes as they are, eg. /caf%C3%A9 and /%75sers become /café and /users,
+// while a%2Fb is still one segment, which is unescaped as a param later.
+func unescapeStatic(p string) string {
+	i := strings.IndexByte(p, '%')
+	if i < 0 {
+		return p
+	}
+
+	b := make([]byte, 0, len(p))
+	b = append(b, p[:i]...)
+	for ; i < len(p); i++ {
+		if p[i] == '%' && i+2 < len(p) && isHex(p[i+1]) && isHex(p[i+2]) {
+			c := unhex(p[i+1])<<4 | unhex(p[i+2])
+			if c != '/' && c != '%' {
+				b = append(b, c)
+				i += 2
+				continue
+			}
+		}
+		b = append(b, p[i])
+	}
+	return string(b)
+}
+
+// escapeSegments escapes each segment of p which is unescaped by
+// unescapeStatic, eg. /café/a%2Fb to /caf%C3%A9/a%2Fb.
+func escapeSegments(p string) string {
+	segs := strings.Split(p, "/")
+	for i, seg := range segs {
+		if v, err := url.PathUnescape(seg); err == nil {
+			segs[i] = url.PathEscape(v)
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	default:
+		return c - '0'
+	}
+}
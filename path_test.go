@@ -0,0 +1,238 @@
+package pi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServerMux_PathPolicy(t *testing.T) {
+	gen := func(b string) HandlerFunc {
+		return func(ctx Context) error {
+			return ctx.Text(b)
+		}
+	}
+	setup := func(opts ...Option) ServerMux {
+		sm := NewServerMux(opts...)
+		sm.Route("/users").Get(gen("users")).Post(gen("users"))
+		sm.Route("/posts/").Get(gen("posts"))
+		sm.Route("/files/:name/Meta").Get(gen("meta"))
+		return sm
+	}
+
+	tests := []struct {
+		name         string
+		sm           ServerMux
+		method       string
+		target       string
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:       "PathClean should match unclean path",
+			sm:         setup(),
+			target:     "//api/../users/",
+			wantStatus: http.StatusOK,
+			wantBody:   "users",
+		},
+		{
+			name:         "PathRedirect should redirect unclean path",
+			sm:           setup(WithPathPolicy(PathRedirect)),
+			target:       "//api/../users?page=1",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "/users?page=1",
+		},
+		{
+			name:         "PathRedirect should remove trailing slash",
+			sm:           setup(WithPathPolicy(PathRedirect)),
+			target:       "/users/",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "/users",
+		},
+		{
+			name:         "PathRedirect should add trailing slash",
+			sm:           setup(WithPathPolicy(PathRedirect)),
+			target:       "/posts",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "/posts/",
+		},
+		{
+			name:         "PathRedirect should keep method by status 308",
+			sm:           setup(WithPathPolicy(PathRedirect)),
+			method:       http.MethodPost,
+			target:       "/users/",
+			wantStatus:   http.StatusPermanentRedirect,
+			wantLocation: "/users",
+		},
+		{
+			name:       "PathStrict should not match trailing slash",
+			sm:         setup(WithPathPolicy(PathStrict)),
+			target:     "/users/",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "PathStrict should not match unclean path",
+			sm:         setup(WithPathPolicy(PathStrict)),
+			target:     "/api/../users",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "PathStrict should match exact path",
+			sm:         setup(WithPathPolicy(PathStrict)),
+			target:     "/posts/",
+			wantStatus: http.StatusOK,
+			wantBody:   "posts",
+		},
+		{
+			name:         "case insensitive should redirect to canonical case",
+			sm:           setup(WithCaseInsensitive()),
+			target:       "/FILES/Avatar.PNG/meta",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "/files/Avatar.PNG/Meta",
+		},
+		{
+			name:       "case sensitive should not match different case",
+			sm:         setup(),
+			target:     "/Users",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(method, tt.target, nil)
+			tt.sm.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status want = %d, got = %d", tt.wantStatus, w.Code)
+			}
+			if v := w.Header().Get("Location"); v != tt.wantLocation {
+				t.Fatalf("header Location want = %s, got = %s", tt.wantLocation, v)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Fatalf("body want = %s, got = %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_cleanPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"", "/"},
+		{"/", "/"},
+		{"//users/", "/users/"},
+		{"/users/../posts", "/posts"},
+		{"/users/./", "/users/"},
+	}
+	for _, tt := range tests {
+		if got := cleanPath(tt.path); got != tt.want {
+			t.Fatalf("cleanPath(%q) want = %s, got = %s", tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestServerMux_EscapedPath(t *testing.T) {
+	gen := func(params ...string) HandlerFunc {
+		return func(ctx Context) error {
+			b := ""
+			for _, p := range params {
+				b += "[" + ctx.Param(p) + "]"
+			}
+			return ctx.Text(b)
+		}
+	}
+	setup := func(opts ...Option) ServerMux {
+		sm := NewServerMux(opts...)
+		sm.Route("/files/:name/meta").Get(gen("name"))
+		sm.Route("/blobs/*path").Get(gen("path"))
+		sm.Route("/café/:name").Get(gen("name"))
+		return sm
+	}
+
+	tests := []struct {
+		name       string
+		sm         ServerMux
+		target     string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "encoded slash should be matched as one segment",
+			sm:         setup(WithEscapedPath()),
+			target:     "/files/a%2Fb/meta",
+			wantStatus: http.StatusOK,
+			wantBody:   "[a/b]",
+		},
+		{
+			name:       "encoded percent sign should be unescaped",
+			sm:         setup(WithEscapedPath()),
+			target:     "/files/100%25/meta",
+			wantStatus: http.StatusOK,
+			wantBody:   "[100%]",
+		},
+		{
+			name:       "wildcard param should be unescaped",
+			sm:         setup(WithEscapedPath()),
+			target:     "/blobs/a%2Fb/c%20d",
+			wantStatus: http.StatusOK,
+			wantBody:   "[a/b/c d]",
+		},
+		{
+			name:       "encoded static segment should be matched",
+			sm:         setup(WithEscapedPath()),
+			target:     "/caf%C3%A9/a%2Fb",
+			wantStatus: http.StatusOK,
+			wantBody:   "[a/b]",
+		},
+		{
+			name:       "encoded unreserved characters should be matched",
+			sm:         setup(WithEscapedPath()),
+			target:     "/%66iles/%61%2525/meta",
+			wantStatus: http.StatusOK,
+			wantBody:   "[a%25]",
+		},
+		{
+			name:       "encoded slash should split segment without option",
+			sm:         setup(),
+			target:     "/files/a%2Fb/meta",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			tt.sm.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status want = %d, got = %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Fatalf("body want = %s, got = %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("redirect should keep escaped path", func(t *testing.T) {
+		sm := setup(WithEscapedPath(), WithPathPolicy(PathRedirect))
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/files/a%2Fb/./meta", nil)
+		sm.ServeHTTP(w, r)
+		if v := w.Header().Get("Location"); v != "/files/a%2Fb/meta" {
+			t.Fatalf("header Location want = /files/a%%2Fb/meta, got = %s", v)
+		}
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/caf%C3%A9/./a%2Fb", nil)
+		sm.ServeHTTP(w, r)
+		if v := w.Header().Get("Location"); v != "/caf%C3%A9/a%2Fb" {
+			t.Fatalf("header Location want = /caf%%C3%%A9/a%%2Fb, got = %s", v)
+		}
+	})
+}
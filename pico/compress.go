@@ -0,0 +1,276 @@
+package pico
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-laeo/pi"
+)
+
+type CompressOptions struct {
+	// Level is the compression level of gzip and deflate, the zero value
+	// means gzip.DefaultCompression, so gzip.NoCompression can not be
+	// selected, just leave Compress out instead. Compress panics if the
+	// level is invalid.
+	Level int
+
+	// MinSize is the minimum size of response body to be compressed,
+	// defaults to 1024 bytes.
+	MinSize int
+
+	// ContentTypes are the compressible media types, a type ends with "/"
+	// matches all subtypes, eg. text/. Defaults to text/, JSON, JavaScript,
+	// XML and SVG, the already compressed types such as images are skipped.
+	ContentTypes []string
+}
+
+var defaultCompressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+// Compress returns a middleware which compresses response body by gzip
+// or deflate (zlib format) according to the Accept-Encoding of request.
+// The small bodies, the partial contents and the incompressible content
+// types are sent as they are, the streaming responses are compressed and
+// flushed by http.Flusher.
+//
+//	sm.Use(pico.Compress(pico.CompressOptions{}))
+func Compress(opts CompressOptions) func(next pi.HandlerFunc) pi.HandlerFunc {
+	if opts.Level == 0 {
+		opts.Level = gzip.DefaultCompression
+	}
+	if opts.MinSize <= 0 {
+		opts.MinSize = 1024
+	}
+	if len(opts.ContentTypes) == 0 {
+		opts.ContentTypes = defaultCompressibleTypes
+	}
+	if _, err := gzip.NewWriterLevel(io.Discard, opts.Level); err != nil {
+		panic("pico: invalid level of Compress: " + err.Error())
+	}
+
+	pools := map[string]*sync.Pool{
+		"gzip": {New: func() any {
+			// the level is checked already.
+			w, _ := gzip.NewWriterLevel(io.Discard, opts.Level)
+			return w
+		}},
+		"deflate": {New: func() any {
+			w, _ := zlib.NewWriterLevel(io.Discard, opts.Level)
+			return w
+		}},
+	}
+
+	return func(next pi.HandlerFunc) pi.HandlerFunc {
+		return func(ctx pi.Context) error {
+			ctx.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(ctx.Get("Accept-Encoding"))
+			if encoding == "" {
+				return next(ctx)
+			}
+
+			w, _ := ctx.Raw()
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				pool:           pools[encoding],
+				opts:           &opts,
+			}
+			err := next(pi.WithWriter(ctx, cw))
+			if cerr := cw.close(); err == nil {
+				err = cerr
+			}
+			return err
+		}
+	}
+}
+
+// negotiateEncoding returns the preferred encoding in header, gzip is
+// preferred over deflate if they have the same quality.
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "gzip" && name != "deflate" && name != "*" {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		if q <= 0 {
+			continue
+		}
+		if name == "*" {
+			name = "gzip"
+		}
+		if q > bestQ || (q == bestQ && name == "gzip") {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressWriter buffers the beginning of response body until it is
+// large enough to decide whether to compress.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	pool     *sync.Pool
+	opts     *CompressOptions
+
+	status  int
+	buf     []byte
+	decided bool
+	cw      compressor // nil if the response is not compressed.
+}
+
+var _ http.Flusher = (*compressWriter)(nil)
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.status != 0 || w.decided {
+		return
+	}
+	if status >= 100 && status < 200 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.opts.MinSize {
+			return len(b), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.cw != nil {
+		return w.cw.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		// streaming responses are compressed regardless of size.
+		w.decide(true)
+	}
+	if w.cw != nil {
+		w.cw.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide sends the header and the buffered body, the body is compressed
+// if compress is true and the response is compressible.
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if compress && w.compressible() {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		w.cw = w.pool.Get().(compressor)
+		w.cw.Reset(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.cw != nil {
+		_, err = w.cw.Write(w.buf)
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf)
+	}
+	w.buf = nil
+	return err
+}
+
+func (w *compressWriter) compressible() bool {
+	switch {
+	case w.status < 200 || w.status == http.StatusNoContent || w.status == http.StatusNotModified:
+		return false
+	case w.Header().Get("Content-Encoding") != "":
+		return false
+	case w.status == http.StatusPartialContent || w.Header().Get("Content-Range") != "":
+		// the range is of the uncompressed body.
+		return false
+	}
+
+	mt, _, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, t := range w.opts.ContentTypes {
+		if mt == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mt, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// close sends the buffered body which is too small to be compressed, or
+// finishes the compressed stream.
+func (w *compressWriter) close() error {
+	if !w.decided {
+		if w.status == 0 {
+			// nothing is written, leaves the response to the error formatter.
+			return nil
+		}
+		return w.decide(false)
+	}
+	if w.cw == nil {
+		return nil
+	}
+
+	err := w.cw.Close()
+	w.cw.Reset(io.Discard)
+	w.pool.Put(w.cw)
+	w.cw = nil
+	return err
+}
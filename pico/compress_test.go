@@ -0,0 +1,134 @@
+package pico
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-laeo/pi"
+)
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat("hello, world! ", 200)
+
+	sm := pi.NewServerMux()
+	sm.Use(Compress(CompressOptions{}))
+	sm.Route("/large").Get(func(ctx pi.Context) error {
+		ctx.Header().Set("Content-Length", "2800")
+		return ctx.Json(map[string]string{"data": large})
+	})
+	sm.Route("/small").Get(func(ctx pi.Context) error {
+		return ctx.Text("hello")
+	})
+	sm.Route("/image").Get(func(ctx pi.Context) error {
+		ctx.Header().Set("Content-Type", "image/png")
+		_, err := ctx.Write([]byte(large))
+		return err
+	})
+	sm.Route("/stream").Get(func(ctx pi.Context) error {
+		ctx.Header().Set("Content-Type", "text/event-stream")
+		w, _ := ctx.Raw()
+		ctx.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		return nil
+	})
+	sm.Route("/error").Get(func(ctx pi.Context) error {
+		return pi.NotFound("")
+	})
+
+	tests := []struct {
+		name     string
+		path     string
+		accept   string
+		encoding string
+		want     string
+	}{
+		{"large json should be gzipped", "/large", "deflate;q=0.5, gzip", "gzip", large},
+		{"deflate should be negotiated", "/large", "gzip;q=0.1, deflate", "deflate", large},
+		{"no accepted encoding", "/large", "br, gzip;q=0", "", large},
+		{"small body should not be compressed", "/small", "gzip", "", "hello"},
+		{"compressed type should not be compressed", "/image", "gzip", "", large},
+		{"streaming response should be compressed", "/stream", "gzip", "gzip", "data: 1\n\n"},
+		{"error should be responded as it is", "/error", "gzip", "", "not_found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set("Accept-Encoding", tt.accept)
+			w := httptest.NewRecorder()
+			sm.ServeHTTP(w, r)
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Fatalf("want Content-Encoding = %s, got = %s", tt.encoding, got)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Fatalf("want Vary = Accept-Encoding, got = %s", got)
+			}
+
+			var body io.Reader = w.Body
+			switch tt.encoding {
+			case "gzip":
+				if w.Header().Get("Content-Length") != "" {
+					t.Fatal("Content-Length should be stripped")
+				}
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = zr
+			case "deflate":
+				zr, err := zlib.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = zr
+			}
+			b, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(b), tt.want) {
+				t.Fatalf("want body contains %q, got = %q", tt.want, b)
+			}
+		})
+	}
+}
+
+func TestCompress_InvalidLevel(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("invalid level should panic at construction")
+		}
+	}()
+	Compress(CompressOptions{Level: 42})
+}
+
+func TestCompress_Range(t *testing.T) {
+	data := strings.Repeat("hello, world! ", 500)
+	root := fstest.MapFS{"a.txt": &fstest.MapFile{Data: []byte(data)}}
+
+	sm := pi.NewServerMux()
+	sm.Use(Compress(CompressOptions{}))
+	sm.Route("/*").Get(pi.FileServer(http.FS(root), "a.txt"))
+
+	r := httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Header.Set("Range", "bytes=0-1999")
+	w := httptest.NewRecorder()
+	sm.ServeHTTP(w, r)
+
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("want status = 206, got = %d", w.Code)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Fatalf("partial content should not be compressed, got Content-Encoding = %s", got)
+	}
+	if w.Body.String() != data[:2000] {
+		t.Fatalf("want body = %d bytes of file, got = %d bytes", 2000, w.Body.Len())
+	}
+}
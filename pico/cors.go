@@ -2,23 +2,153 @@ package pico
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-laeo/pi"
 )
 
-func Cors(next pi.HandlerFunc) pi.HandlerFunc {
-	return func(ctx pi.Context) error {
-		ctx.Header().Set("Access-Control-Allow-Origin", "*")
-		ctx.Header().Set("Access-Control-Allow-Credentials", "true")
-
-		if ctx.Is(http.MethodOptions) {
-			ctx.Header().Set("Access-Control-Methods", "POST, PUT, PATCH, DELETE")
-			ctx.Header().Set("Access-Control-Allow-Headers", "*")
-			ctx.Header().Set("Access-Control-Max-Age", "86400")
-			ctx.Code(http.StatusNoContent)
-			return nil
+type CORSOptions struct {
+	// AllowOrigins are the origins which can access the resources, an
+	// origin can be exact, eg. https://example.com, or contains a wildcard
+	// subdomain, eg. https://*.example.com, or "*" to allow all origins.
+	AllowOrigins []string
+
+	// AllowOriginFunc reports whether origin is allowed, it is checked
+	// if origin does not match AllowOrigins.
+	AllowOriginFunc func(origin string) bool
+
+	// AllowMethods are the methods allowed in preflight requests, defaults
+	// to GET, HEAD, POST, PUT, PATCH and DELETE.
+	AllowMethods []string
+
+	// AllowHeaders are the headers allowed in preflight requests, the
+	// headers requested by Access-Control-Request-Headers are allowed if
+	// it is empty.
+	AllowHeaders []string
+
+	// ExposeHeaders are the response headers which can be read by client.
+	ExposeHeaders []string
+
+	// AllowCredentials allows client to send cookies, the requested origin
+	// is responded instead of "*" if it is true.
+	AllowCredentials bool
+
+	// MaxAge is how long the results of preflight requests can be cached.
+	MaxAge time.Duration
+}
+
+// CORS returns a middleware which handles cross-origin requests according
+// to opts, the preflight requests are answered without calling next.
+//
+//	sm.Use(pico.CORS(pico.CORSOptions{
+//		AllowOrigins:     []string{"https://example.com", "https://*.example.com"},
+//		AllowCredentials: true,
+//	}))
+func CORS(opts CORSOptions) func(next pi.HandlerFunc) pi.HandlerFunc {
+	allowAll := false
+	exact := make(map[string]bool)
+	var wildcards [][2]string
+	for _, o := range opts.AllowOrigins {
+		o = strings.ToLower(o)
+		switch i := strings.IndexByte(o, '*'); {
+		case o == "*":
+			allowAll = true
+		case i >= 0:
+			wildcards = append(wildcards, [2]string{o[:i], o[i+1:]})
+		default:
+			exact[o] = true
+		}
+	}
+
+	allowed := func(origin string) bool {
+		if allowAll {
+			return true
+		}
+		o := strings.ToLower(origin)
+		if exact[o] {
+			return true
+		}
+		for _, w := range wildcards {
+			if len(o) > len(w[0])+len(w[1]) && strings.HasPrefix(o, w[0]) && strings.HasSuffix(o, w[1]) {
+				return true
+			}
 		}
+		return opts.AllowOriginFunc != nil && opts.AllowOriginFunc(origin)
+	}
+
+	methods := opts.AllowMethods
+	if len(methods) == 0 {
+		methods = []string{
+			http.MethodGet,
+			http.MethodHead,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+		}
+	}
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(opts.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(opts.ExposeHeaders, ", ")
+	maxAge := ""
+	if opts.MaxAge > 0 {
+		maxAge = strconv.Itoa(int(opts.MaxAge / time.Second))
+	}
+	// the responses differ by origin unless all origins get "*".
+	varyOrigin := !allowAll || opts.AllowCredentials
+
+	return func(next pi.HandlerFunc) pi.HandlerFunc {
+		return func(ctx pi.Context) error {
+			h := ctx.Header()
+			if varyOrigin {
+				h.Add("Vary", "Origin")
+			}
+
+			origin := ctx.Get("Origin")
+			if origin == "" || !allowed(origin) {
+				return next(ctx)
+			}
 
-		return next(ctx)
+			if allowAll && !opts.AllowCredentials {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if opts.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			preflight := ctx.Is(http.MethodOptions) && ctx.Get("Access-Control-Request-Method") != ""
+			if !preflight {
+				if exposeHeaders != "" {
+					h.Set("Access-Control-Expose-Headers", exposeHeaders)
+				}
+				return next(ctx)
+			}
+
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", allowMethods)
+			if allowHeaders != "" {
+				h.Set("Access-Control-Allow-Headers", allowHeaders)
+			} else if requested := ctx.Get("Access-Control-Request-Headers"); requested != "" {
+				h.Set("Access-Control-Allow-Headers", requested)
+			}
+			if maxAge != "" {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+			return ctx.Code(http.StatusNoContent)
+		}
 	}
 }
+
+var cors = CORS(CORSOptions{AllowOrigins: []string{"*"}, MaxAge: 24 * time.Hour})
+
+// Cors allows all origins to access the resources.
+//
+// Deprecated: use CORS instead.
+func Cors(next pi.HandlerFunc) pi.HandlerFunc {
+	return cors(next)
+}
@@ -0,0 +1,126 @@
+package pico
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-laeo/pi"
+)
+
+func TestCORS(t *testing.T) {
+	sm := pi.NewServerMux()
+	sm.Use(CORS(CORSOptions{
+		AllowOrigins:     []string{"https://example.com", "https://*.example.org"},
+		AllowOriginFunc:  func(origin string) bool { return strings.HasSuffix(origin, ".test") },
+		ExposeHeaders:    []string{"X-Total"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	}))
+	sm.Route("/users").Post(func(ctx pi.Context) error {
+		return ctx.Text("created")
+	})
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		status  int
+		want    map[string]string
+	}{
+		{
+			name:    "exact origin should be allowed",
+			method:  http.MethodPost,
+			headers: map[string]string{"Origin": "https://example.com"},
+			status:  200,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "https://example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Total",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			name:    "wildcard subdomain should be allowed",
+			method:  http.MethodPost,
+			headers: map[string]string{"Origin": "https://api.example.org"},
+			status:  200,
+			want:    map[string]string{"Access-Control-Allow-Origin": "https://api.example.org"},
+		},
+		{
+			name:    "origin allowed by func",
+			method:  http.MethodPost,
+			headers: map[string]string{"Origin": "http://local.test"},
+			status:  200,
+			want:    map[string]string{"Access-Control-Allow-Origin": "http://local.test"},
+		},
+		{
+			name:    "disallowed origin should not get CORS headers",
+			method:  http.MethodPost,
+			headers: map[string]string{"Origin": "https://example.org"},
+			status:  200,
+			want:    map[string]string{"Access-Control-Allow-Origin": "", "Vary": "Origin"},
+		},
+		{
+			name:   "preflight should be answered",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "Content-Type",
+			},
+			status: 204,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":   "https://example.com",
+				"Access-Control-Allow-Methods":  "GET, HEAD, POST, PUT, PATCH, DELETE",
+				"Access-Control-Allow-Headers":  "Content-Type",
+				"Access-Control-Max-Age":        "3600",
+				"Access-Control-Expose-Headers": "",
+			},
+		},
+		{
+			name:    "OPTIONS without request method is not preflight",
+			method:  http.MethodOptions,
+			headers: map[string]string{"Origin": "https://example.com"},
+			status:  204,
+			want: map[string]string{
+				"Access-Control-Allow-Methods": "",
+				"Allow":                        "OPTIONS, POST",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/users", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			sm.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("want status = %d, got = %d", tt.status, w.Code)
+			}
+			for k, v := range tt.want {
+				if got := w.Header().Get(k); got != v {
+					t.Fatalf("want %s = %s, got = %s", k, v, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCORS_AllowAll(t *testing.T) {
+	h := Cors(func(ctx pi.Context) error { return nil })
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Origin", "https://example.com")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Fatalf("want origin = *, got = %s", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Fatalf("credentials should not be allowed with *, got = %s", got)
+	}
+}
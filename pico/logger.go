@@ -0,0 +1,132 @@
+package pico
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-laeo/pi"
+)
+
+type LoggerOptions struct {
+	// Logger emits the access logs, defaults to slog.Default().
+	Logger *slog.Logger
+
+	// Message is the message of access logs, defaults to "request".
+	Message string
+
+	// Level maps the status and error of request to log level, defaults
+	// to Error for 5xx responses, Warn for 4xx ones, otherwise Info.
+	Level func(status int, err error) slog.Level
+
+	// SkipPaths are the route patterns or request paths not to be logged,
+	// eg. /health.
+	SkipPaths []string
+
+	// Skip reports whether the request should not be logged.
+	Skip func(ctx pi.Context) bool
+}
+
+// Logger returns a middleware which logs every request by log/slog with
+// the method, route pattern, status, size, latency, client IP, request
+// ID and error of request. The request ID is logged if RequestID is
+// applied before Logger.
+//
+//	sm.Use(pico.Logger(pico.LoggerOptions{SkipPaths: []string{"/health"}}))
+//
+// NOTE: the middleware of (ServerMux).Use() only wrap matched routes, the
+// requests answered by the not found and method not allowed handlers, and
+// the redirections of path policies are NOT logged. Wrap the handlers to
+// log the former two:
+//
+//	logger := pico.Logger(pico.LoggerOptions{})
+//	sm.Use(logger)
+//	sm.SetNotFoundHandler(logger(notFound))
+//	sm.SetMethodNotAllowedHandler(logger(methodNotAllowed))
+func Logger(opts LoggerOptions) func(next pi.HandlerFunc) pi.HandlerFunc {
+	if opts.Message == "" {
+		opts.Message = "request"
+	}
+	if opts.Level == nil {
+		opts.Level = defaultLevel
+	}
+	skips := make(map[string]bool, len(opts.SkipPaths))
+	for _, p := range opts.SkipPaths {
+		skips[p] = true
+	}
+
+	return func(next pi.HandlerFunc) pi.HandlerFunc {
+		return func(ctx pi.Context) error {
+			if skips[ctx.Pattern()] || skips[ctx.URL().Path] || (opts.Skip != nil && opts.Skip(ctx)) {
+				return next(ctx)
+			}
+
+			start := time.Now()
+			err := next(ctx)
+			latency := time.Since(start)
+
+			status := ctx.Status()
+			if status == 0 {
+				status = errorStatus(err)
+			}
+
+			logger := opts.Logger
+			if logger == nil {
+				logger = slog.Default()
+			}
+			level := opts.Level(status, err)
+			if !logger.Enabled(ctx.Context(), level) {
+				return err
+			}
+
+			attrs := []slog.Attr{
+				slog.String("method", ctx.Method()),
+				slog.String("pattern", ctx.Pattern()),
+				slog.Int("status", status),
+				slog.Int64("size", ctx.Size()),
+				slog.Duration("latency", latency),
+				slog.String("ip", ctx.IP()),
+			}
+			if id := pi.RequestID(ctx); id != "" {
+				attrs = append(attrs, slog.String("request_id", id))
+			}
+			if err != nil {
+				attrs = append(attrs, slog.String("error", err.Error()))
+			}
+			logger.LogAttrs(ctx.Context(), level, opts.Message, attrs...)
+
+			return err
+		}
+	}
+}
+
+// errorStatus returns the status which err will be responded with by the
+// default error formatter, or 200 if err is nil.
+func errorStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	var he *pi.HTTPError
+	if errors.As(err, &he) {
+		return he.Status
+	}
+	if errors.Is(err, pi.ErrHandlerNotFound) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, pi.ErrMethodNotAllowed) {
+		return http.StatusMethodNotAllowed
+	}
+	return http.StatusInternalServerError
+}
+
+func defaultLevel(status int, err error) slog.Level {
+	switch {
+	case status >= 500:
+		return slog.LevelError
+	case status >= 400:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
@@ -0,0 +1,99 @@
+package pico
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-laeo/pi"
+)
+
+func TestLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sm := pi.NewServerMux()
+	sm.Use(RequestID(RequestIDOptions{}))
+	sm.Use(Logger(LoggerOptions{
+		Logger:    slog.New(slog.NewJSONHandler(buf, nil)),
+		SkipPaths: []string{"/health"},
+	}))
+	sm.Route("/users/:id").Get(func(ctx pi.Context) error {
+		return ctx.Text("hello")
+	})
+	sm.Route("/teams/:id").Get(func(ctx pi.Context) error {
+		return pi.NotFound("")
+	})
+	sm.Route("/health").Get(func(ctx pi.Context) error {
+		return ctx.Code(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name    string
+		path    string
+		skipped bool
+		want    map[string]any
+	}{
+		{
+			name: "route pattern should be logged",
+			path: "/users/1",
+			want: map[string]any{"level": "INFO", "method": "GET", "pattern": "/users/:id", "status": 200.0, "size": 5.0, "ip": "192.0.2.1", "request_id": "abc"},
+		},
+		{
+			name: "error should be logged with its status",
+			path: "/teams/1",
+			want: map[string]any{"level": "WARN", "pattern": "/teams/:id", "status": 404.0, "error": "Not Found"},
+		},
+		{
+			name:    "skipped paths should not be logged",
+			path:    "/health",
+			skipped: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set("X-Request-Id", "abc")
+			sm.ServeHTTP(httptest.NewRecorder(), r)
+
+			if tt.skipped {
+				if buf.Len() > 0 {
+					t.Fatalf("want nothing logged, got = %s", buf.String())
+				}
+				return
+			}
+
+			got := map[string]any{}
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Fatalf("want %s = %v, got = %v", k, v, got[k])
+				}
+			}
+		})
+	}
+}
+
+func TestLogger_NotFound(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := Logger(LoggerOptions{Logger: slog.New(slog.NewJSONHandler(buf, nil))})
+
+	sm := pi.NewServerMux()
+	sm.Use(logger)
+	sm.SetNotFoundHandler(logger(func(ctx pi.Context) error {
+		return ctx.Code(http.StatusNotFound)
+	}))
+	sm.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nope", nil))
+
+	got := map[string]any{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("not found request should be logged by the wrapped handler, got = %s", buf.String())
+	}
+	if got["status"] != 404.0 {
+		t.Fatalf("want status = 404, got = %v", got["status"])
+	}
+}
@@ -0,0 +1,204 @@
+package pico
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-laeo/pi"
+)
+
+// now is replaced in tests.
+var now = time.Now
+
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket allows bursts up to the limit, and refills the quota
+	// continuously in the window.
+	TokenBucket RateLimitAlgorithm = iota
+
+	// SlidingWindow counts the requests in the current fixed window and
+	// the weighted previous window, it does not allow bursts across the
+	// boundary of windows.
+	SlidingWindow
+)
+
+type RateLimitOptions struct {
+	// Limit is the maximum number of requests in Window.
+	Limit int
+
+	// Window is the period of Limit, defaults to 1 minute.
+	Window time.Duration
+
+	// Algorithm defaults to TokenBucket.
+	Algorithm RateLimitAlgorithm
+
+	// Key extracts the key of request to be limited, eg. KeyByIP,
+	// KeyByHeader("X-Api-Key") or KeyByRoute(KeyByIP), defaults to
+	// KeyByIP. The request is not limited if the key is empty.
+	Key func(ctx pi.Context) string
+
+	// Store keeps the states of limits, defaults to a MemoryStore.
+	Store Store
+}
+
+// RateLimitResult is the result of taking a request from the quota.
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+
+	// Reset is the time until the quota is fully restored.
+	Reset time.Duration
+
+	// RetryAfter is the time until the next request is allowed, it is
+	// only available if the request is not allowed.
+	RetryAfter time.Duration
+}
+
+// RateLimit returns a middleware which limits the rate of requests by key,
+// it sends the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset
+// headers, and returns a 429 error with Retry-After header if the limit
+// exceeds.
+//
+//	sm.Use(pico.RateLimit(pico.RateLimitOptions{Limit: 100, Window: time.Minute}))
+func RateLimit(opts RateLimitOptions) func(next pi.HandlerFunc) pi.HandlerFunc {
+	if opts.Limit <= 0 {
+		panic("pico: limit of RateLimit must be positive")
+	}
+	if opts.Window <= 0 {
+		opts.Window = time.Minute
+	}
+	if opts.Key == nil {
+		opts.Key = KeyByIP
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+
+	take, ttl := takeTokenBucket, opts.Window
+	if opts.Algorithm == SlidingWindow {
+		take, ttl = takeSlidingWindow, 2*opts.Window
+	}
+	limit := strconv.Itoa(opts.Limit)
+
+	return func(next pi.HandlerFunc) pi.HandlerFunc {
+		return func(ctx pi.Context) error {
+			key := opts.Key(ctx)
+			if key == "" {
+				return next(ctx)
+			}
+
+			var res RateLimitResult
+			t := now()
+			err := opts.Store.Update(key, ttl, func(s *RateLimitState) {
+				res = take(s, opts.Limit, opts.Window, t)
+			})
+			if err != nil {
+				return err
+			}
+
+			h := ctx.Header()
+			h.Set("RateLimit-Limit", limit)
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", seconds(res.Reset))
+			if !res.Allowed {
+				h.Set("Retry-After", seconds(res.RetryAfter))
+				return pi.TooManyRequests("")
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// KeyByIP limits requests by client IP.
+func KeyByIP(ctx pi.Context) string {
+	return ctx.IP()
+}
+
+// KeyByHeader limits requests by the value of request header, eg. an API
+// key, the requests without the header are limited by client IP.
+func KeyByHeader(name string) func(ctx pi.Context) string {
+	return func(ctx pi.Context) string {
+		if v := ctx.Get(name); v != "" {
+			return name + ":" + v
+		}
+		return "ip:" + ctx.IP()
+	}
+}
+
+// KeyByRoute limits requests by key for each route separately.
+func KeyByRoute(key func(ctx pi.Context) string) func(ctx pi.Context) string {
+	return func(ctx pi.Context) string {
+		k := key(ctx)
+		if k == "" {
+			return ""
+		}
+		return ctx.Pattern() + " " + k
+	}
+}
+
+// takeTokenBucket takes a token from the bucket which holds limit tokens
+// at most and is refilled by limit tokens every window, s.Value is the
+// tokens left at s.At.
+func takeTokenBucket(s *RateLimitState, limit int, window time.Duration, t time.Time) RateLimitResult {
+	capacity := float64(limit)
+	rate := capacity / float64(window) // tokens per nanosecond.
+
+	tokens := capacity
+	if !s.At.IsZero() {
+		tokens = math.Min(capacity, s.Value+float64(t.Sub(s.At))*rate)
+	}
+
+	res := RateLimitResult{}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - tokens) / rate)
+	}
+	s.Value, s.At = tokens, t
+
+	res.Remaining = int(tokens)
+	res.Reset = time.Duration((capacity - tokens) / rate)
+	return res
+}
+
+// takeSlidingWindow counts a request in the window starts at s.At, s.Value
+// is the count of current window and s.Prev is the count of previous one.
+func takeSlidingWindow(s *RateLimitState, limit int, window time.Duration, t time.Time) RateLimitResult {
+	start := t.Truncate(window)
+	if !s.At.Equal(start) {
+		if s.At.Equal(start.Add(-window)) {
+			s.Prev = s.Value
+		} else {
+			s.Prev = 0
+		}
+		s.Value, s.At = 0, start
+	}
+
+	elapsed := t.Sub(start)
+	weight := 1 - float64(elapsed)/float64(window)
+	count := s.Prev*weight + s.Value
+
+	res := RateLimitResult{Reset: window - elapsed}
+	if count+1 <= float64(limit) {
+		s.Value++
+		count++
+		res.Allowed = true
+	} else {
+		// waits until the weighted previous window leaves room for one more.
+		res.RetryAfter = res.Reset
+		if s.Prev > 0 && s.Value+1 <= float64(limit) {
+			f := 1 - (float64(limit)-1-s.Value)/s.Prev
+			res.RetryAfter = time.Duration(f*float64(window)) - elapsed
+		}
+	}
+	res.Remaining = int(math.Max(0, float64(limit)-count))
+	return res
+}
+
+// seconds formats d as seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
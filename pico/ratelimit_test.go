@@ -0,0 +1,133 @@
+package pico
+
+import (
+	"hash/maphash"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-laeo/pi"
+)
+
+func setNow(t *testing.T, at time.Time) *time.Time {
+	current := at
+	now = func() time.Time { return current }
+	t.Cleanup(func() { now = time.Now })
+	return &current
+}
+
+func TestRateLimit(t *testing.T) {
+	clock := setNow(t, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	sm := pi.NewServerMux()
+	sm.Use(RateLimit(RateLimitOptions{
+		Limit:  2,
+		Window: time.Minute,
+		Key:    KeyByRoute(KeyByHeader("X-Api-Key")),
+	}))
+	sm.Route("/a").Get(func(ctx pi.Context) error { return ctx.Text("a") })
+	sm.Route("/b").Get(func(ctx pi.Context) error { return ctx.Text("b") })
+
+	serve := func(path, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("X-Api-Key", key)
+		w := httptest.NewRecorder()
+		sm.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		key        string
+		advance    time.Duration
+		status     int
+		remaining  string
+		retryAfter string
+	}{
+		{name: "first request", path: "/a", key: "k1", status: 200, remaining: "1"},
+		{name: "second request", path: "/a", key: "k1", status: 200, remaining: "0"},
+		{name: "exceeded", path: "/a", key: "k1", status: 429, remaining: "0", retryAfter: "30"},
+		{name: "other key", path: "/a", key: "k2", status: 200, remaining: "1"},
+		{name: "other route", path: "/b", key: "k1", status: 200, remaining: "1"},
+		{name: "refilled", path: "/a", key: "k1", advance: 30 * time.Second, status: 200, remaining: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*clock = clock.Add(tt.advance)
+			w := serve(tt.path, tt.key)
+			if w.Code != tt.status {
+				t.Fatalf("want status = %d, got = %d", tt.status, w.Code)
+			}
+			if got := w.Header().Get("RateLimit-Limit"); got != "2" {
+				t.Fatalf("want RateLimit-Limit = 2, got = %s", got)
+			}
+			if got := w.Header().Get("RateLimit-Remaining"); got != tt.remaining {
+				t.Fatalf("want RateLimit-Remaining = %s, got = %s", tt.remaining, got)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.retryAfter {
+				t.Fatalf("want Retry-After = %s, got = %s", tt.retryAfter, got)
+			}
+		})
+	}
+}
+
+func TestTakeSlidingWindow(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &RateLimitState{}
+
+	tests := []struct {
+		name    string
+		at      time.Duration
+		allowed bool
+	}{
+		{"first", 0, true},
+		{"second", time.Second, true},
+		{"third", 2 * time.Second, true},
+		{"exceeded", 3 * time.Second, false},
+		// previous window counts 3 * 0.5, so one more is allowed.
+		{"half of next window", 90 * time.Second, true},
+		{"exceeded in next window", 91 * time.Second, false},
+		{"after two windows", 5 * time.Minute, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := takeSlidingWindow(s, 3, time.Minute, start.Add(tt.at))
+			if res.Allowed != tt.allowed {
+				t.Fatalf("want allowed = %v, got = %+v", tt.allowed, res)
+			}
+			if !res.Allowed && res.RetryAfter <= 0 {
+				t.Fatalf("want positive retry after, got = %v", res.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	clock := setNow(t, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := NewMemoryStore()
+
+	incr := func(key string) (v float64) {
+		store.Update(key, time.Minute, func(s *RateLimitState) {
+			s.Value++
+			v = s.Value
+		})
+		return
+	}
+
+	if incr("a") != 1 || incr("a") != 2 || incr("b") != 1 {
+		t.Fatal("states should be kept by key")
+	}
+
+	*clock = clock.Add(2 * time.Minute)
+	if incr("a") != 1 {
+		t.Fatal("expired state should be reset")
+	}
+
+	// the shard of a is swept, b is also removed if it is in the same shard.
+	sh := &store.shards[maphash.String(store.seed, "a")%storeShards]
+	if n := len(sh.states); n != 1 {
+		t.Fatalf("expired states should be removed, got %d states", n)
+	}
+}
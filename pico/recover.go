@@ -0,0 +1,93 @@
+package pico
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+
+	"github.com/go-laeo/pi"
+)
+
+// ErrPanic is wrapped by the error which is converted from a panic.
+var ErrPanic = errors.New("panic")
+
+type RecoverOptions struct {
+	// Stack captures the stack trace of the panicking goroutine, it is
+	// logged or passed to OnPanic.
+	Stack bool
+
+	// StackSize limits the size of captured stack trace, defaults to 4KB.
+	StackSize int
+
+	// OnPanic is called with the recovered value and the captured stack,
+	// the panic is logged by the standard logger if OnPanic is nil.
+	OnPanic func(ctx pi.Context, v any, stack []byte)
+
+	// RepanicAbort panics http.ErrAbortHandler again, so net/http aborts
+	// the response silently instead of sending an error to client.
+	RepanicAbort bool
+}
+
+// Recover returns a middleware which recovers panics of the subsequent
+// handlers, the panic is converted to a 500 error which is responded by
+// the error formatter of ServerMux.
+//
+//	sm.Use(pico.Recover(pico.RecoverOptions{Stack: true}))
+func Recover(opts RecoverOptions) func(next pi.HandlerFunc) pi.HandlerFunc {
+	if opts.StackSize <= 0 {
+		opts.StackSize = 4 << 10
+	}
+
+	return func(next pi.HandlerFunc) pi.HandlerFunc {
+		return func(ctx pi.Context) (err error) {
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if opts.RepanicAbort && v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				var stack []byte
+				if opts.Stack {
+					stack = make([]byte, opts.StackSize)
+					stack = stack[:runtime.Stack(stack, false)]
+				}
+
+				if opts.OnPanic != nil {
+					opts.OnPanic(ctx, v, stack)
+				} else if stack != nil {
+					log.Printf("pico: panic serving %s %s: %v\n%s", ctx.Method(), ctx.URL(), v, stack)
+				} else {
+					log.Printf("pico: panic serving %s %s: %v", ctx.Method(), ctx.URL(), v)
+				}
+
+				err = pi.InternalServerError("").Wrap(&panicError{v: v})
+			}()
+
+			return next(ctx)
+		}
+	}
+}
+
+// panicError is the recovered value of a panic, it matches ErrPanic and
+// unwraps to the value if the value is an error.
+type panicError struct {
+	v any
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrPanic, e.v)
+}
+
+func (e *panicError) Is(target error) bool {
+	return target == ErrPanic
+}
+
+func (e *panicError) Unwrap() error {
+	err, _ := e.v.(error)
+	return err
+}
@@ -0,0 +1,71 @@
+package pico
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-laeo/pi"
+)
+
+func TestRecover(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+
+	var recovered any
+	var stack []byte
+	var formatted error
+
+	sm := pi.NewServerMux()
+	sm.SetErrorFormatter(func(ctx pi.Context, err error) {
+		formatted = err
+		ctx.Error(http.StatusInternalServerError, &pi.ErrorResult{Error: "internal_server_error"})
+	})
+	sm.Use(Recover(RecoverOptions{
+		Stack: true,
+		OnPanic: func(ctx pi.Context, v any, s []byte) {
+			recovered, stack = v, s
+		},
+	}))
+	sm.Route("/panic").Get(func(ctx pi.Context) error {
+		panic("boom")
+	})
+	sm.Route("/error").Get(func(ctx pi.Context) error {
+		panic(io.ErrUnexpectedEOF)
+	})
+
+	w := httptest.NewRecorder()
+	sm.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("want status = 500, got = %d", w.Code)
+	}
+	if recovered != "boom" || !strings.Contains(string(stack), "TestRecover") {
+		t.Fatalf("want recovered boom with stack, got = %v, %s", recovered, stack)
+	}
+	if !errors.Is(formatted, ErrPanic) {
+		t.Fatalf("want error wraps ErrPanic, got = %v", formatted)
+	}
+
+	sm.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/error", nil))
+	if !errors.Is(formatted, ErrPanic) || !errors.Is(formatted, io.ErrUnexpectedEOF) {
+		t.Fatalf("want error wraps ErrPanic and the panic value, got = %v", formatted)
+	}
+}
+
+func TestRecover_RepanicAbort(t *testing.T) {
+	h := Recover(RecoverOptions{RepanicAbort: true})(func(ctx pi.Context) error {
+		panic(http.ErrAbortHandler)
+	})
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Fatalf("want http.ErrAbortHandler re-panicked, got = %v", v)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
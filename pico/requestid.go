@@ -0,0 +1,68 @@
+package pico
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/go-laeo/pi"
+)
+
+type RequestIDOptions struct {
+	// Header is the request and response header carries the request ID,
+	// defaults to X-Request-Id.
+	Header string
+
+	// Generator generates the ID if the request does not carry a valid
+	// one, defaults to 32 random hexadecimal characters.
+	Generator func() string
+}
+
+// maxRequestIDLength limits the size of request ID sent by client.
+const maxRequestIDLength = 128
+
+// RequestID returns a middleware which reads the request ID from request
+// header or generates a new one, the ID is stored in the context of
+// request, see pi.RequestID(), and sent back by the response header.
+//
+//	sm.Use(pico.RequestID(pico.RequestIDOptions{}))
+func RequestID(opts RequestIDOptions) func(next pi.HandlerFunc) pi.HandlerFunc {
+	if opts.Header == "" {
+		opts.Header = "X-Request-Id"
+	}
+	if opts.Generator == nil {
+		opts.Generator = generateRequestID
+	}
+
+	return func(next pi.HandlerFunc) pi.HandlerFunc {
+		return func(ctx pi.Context) error {
+			id := ctx.Get(opts.Header)
+			if !validRequestID(id) {
+				id = opts.Generator()
+			}
+
+			ctx.SetContext(pi.WithRequestID(ctx.Context(), id))
+			ctx.Header().Set(opts.Header, id)
+			return next(ctx)
+		}
+	}
+}
+
+func generateRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID reports whether id is safe to be logged and echoed,
+// it must be printable ASCII without spaces.
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
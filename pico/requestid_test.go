@@ -0,0 +1,68 @@
+package pico
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-laeo/pi"
+)
+
+func TestRequestID(t *testing.T) {
+	sm := pi.NewServerMux()
+	sm.Use(RequestID(RequestIDOptions{}))
+	sm.Route("/").Get(func(ctx pi.Context) error {
+		return ctx.Text(pi.RequestID(ctx))
+	})
+	sm.Route("/error").Get(func(ctx pi.Context) error {
+		return pi.BadRequest("")
+	})
+
+	tests := []struct {
+		name     string
+		path     string
+		id       string
+		generate bool
+	}{
+		{"request ID should be propagated", "/", "abc-123", false},
+		{"missing request ID should be generated", "/", "", true},
+		{"invalid request ID should be replaced", "/", "a b\n", true},
+		{"too long request ID should be replaced", "/", strings.Repeat("a", maxRequestIDLength+1), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set("X-Request-Id", tt.id)
+			w := httptest.NewRecorder()
+			sm.ServeHTTP(w, r)
+
+			got := w.Header().Get("X-Request-Id")
+			if got != w.Body.String() {
+				t.Fatalf("want response header = %s, got = %s", w.Body.String(), got)
+			}
+			if tt.generate && (got == tt.id || len(got) != 32) {
+				t.Fatalf("want generated request ID, got = %s", got)
+			}
+			if !tt.generate && got != tt.id {
+				t.Fatalf("want request ID = %s, got = %s", tt.id, got)
+			}
+		})
+	}
+
+	t.Run("error response should contain request ID", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/error", nil)
+		r.Header.Set("X-Request-Id", "abc-123")
+		w := httptest.NewRecorder()
+		sm.ServeHTTP(w, r)
+
+		result := pi.ErrorResult{}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		if result.RequestID != "abc-123" {
+			t.Fatalf("want request_id = abc-123, got = %s", result.RequestID)
+		}
+	})
+}
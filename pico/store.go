@@ -0,0 +1,85 @@
+package pico
+
+import (
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+// RateLimitState is the state of a rate limit key, the meanings of fields
+// depend on the algorithm.
+type RateLimitState struct {
+	Value float64
+	Prev  float64
+	At    time.Time
+}
+
+// Store keeps the states of rate limits.
+type Store interface {
+	// Update calls fn with the state of key atomically, a zero state is
+	// passed if key does not exist or has expired. The state expires after
+	// ttl since the last update.
+	Update(key string, ttl time.Duration, fn func(s *RateLimitState)) error
+}
+
+const storeShards = 64
+
+// sweepInterval is the minimum interval of removing expired states of a shard.
+const sweepInterval = time.Minute
+
+var _ Store = (*MemoryStore)(nil)
+
+// MemoryStore is a Store in memory, the keys are sharded to reduce lock
+// contention, the expired states are removed lazily on updates.
+type MemoryStore struct {
+	seed   maphash.Seed
+	shards [storeShards]shard
+}
+
+type shard struct {
+	mu      sync.Mutex
+	states  map[string]*entry
+	sweepAt time.Time
+}
+
+type entry struct {
+	state    RateLimitState
+	expireAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{seed: maphash.MakeSeed()}
+	for i := range s.shards {
+		s.shards[i].states = make(map[string]*entry)
+	}
+	return s
+}
+
+func (s *MemoryStore) Update(key string, ttl time.Duration, fn func(s *RateLimitState)) error {
+	sh := &s.shards[maphash.String(s.seed, key)%storeShards]
+	t := now()
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if t.After(sh.sweepAt) {
+		for k, e := range sh.states {
+			if t.After(e.expireAt) {
+				delete(sh.states, k)
+			}
+		}
+		sh.sweepAt = t.Add(sweepInterval)
+	}
+
+	e, ok := sh.states[key]
+	if !ok {
+		e = &entry{}
+		sh.states[key] = e
+	} else if t.After(e.expireAt) {
+		e.state = RateLimitState{}
+	}
+
+	fn(&e.state)
+	e.expireAt = t.Add(ttl)
+	return nil
+}
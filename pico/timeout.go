@@ -0,0 +1,168 @@
+package pico
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-laeo/pi"
+)
+
+type TimeoutOptions struct {
+	// Timeout is the time limit of handling a request.
+	Timeout time.Duration
+
+	// Routes overrides Timeout by route pattern, eg. /uploads/*path, zero
+	// or negative duration disables the time limit of the route.
+	Routes map[string]time.Duration
+
+	// Status is the HTTP status responded when the time limit exceeds,
+	// defaults to 503, it can also be 504.
+	Status int
+}
+
+// Timeout returns a middleware which limits the time of handling a
+// request to d, see TimeoutWith.
+//
+//	sm.Use(pico.Timeout(5 * time.Second))
+func Timeout(d time.Duration) func(next pi.HandlerFunc) pi.HandlerFunc {
+	return TimeoutWith(TimeoutOptions{Timeout: d})
+}
+
+// TimeoutWith returns a middleware which attaches a deadline to the
+// context of request, and calls next in another goroutine with buffered
+// response. If next does not return before the deadline, the buffered
+// response is discarded and a 503 error is returned instead, the writes
+// of next after that fail with http.ErrHandlerTimeout.
+func TimeoutWith(opts TimeoutOptions) func(next pi.HandlerFunc) pi.HandlerFunc {
+	if opts.Status == 0 {
+		opts.Status = http.StatusServiceUnavailable
+	}
+
+	return func(next pi.HandlerFunc) pi.HandlerFunc {
+		return func(ctx pi.Context) error {
+			d := opts.Timeout
+			if o, ok := opts.Routes[ctx.Pattern()]; ok {
+				d = o
+			}
+			if d <= 0 {
+				return next(ctx)
+			}
+
+			c, cancel := context.WithTimeout(ctx.Context(), d)
+			defer cancel()
+
+			w, _ := ctx.Raw()
+			tw := &timeoutWriter{w: w, h: w.Header().Clone()}
+			tctx := pi.WithWriter(ctx, tw)
+			tctx.SetContext(c)
+
+			done := make(chan error, 1)
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				done <- next(tctx)
+			}()
+
+			select {
+			case p := <-panicked:
+				// panics in the caller's goroutine, so it can be recovered.
+				panic(p)
+			case err := <-done:
+				if errors.Is(err, context.DeadlineExceeded) && errors.Is(c.Err(), context.DeadlineExceeded) {
+					tw.timeout()
+					return timeoutError(opts.Status, err)
+				}
+				return tw.flush(err)
+			case <-c.Done():
+				tw.timeout()
+				if errors.Is(c.Err(), context.DeadlineExceeded) {
+					return timeoutError(opts.Status, c.Err())
+				}
+				// the request is canceled by client.
+				return c.Err()
+			}
+		}
+	}
+}
+
+func timeoutError(status int, err error) error {
+	return pi.NewError(status, "").WithCode("timeout").Wrap(err)
+}
+
+// timeoutWriter buffers the response until the handler returns.
+type timeoutWriter struct {
+	w http.ResponseWriter
+	h http.Header
+
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = status
+}
+
+func (tw *timeoutWriter) timeout() {
+	tw.mu.Lock()
+	tw.timedOut = true
+	tw.mu.Unlock()
+}
+
+// flush sends the buffered response to the underlying writer, err is
+// returned as it is.
+func (tw *timeoutWriter) flush(err error) error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	dst := tw.w.Header()
+	for k := range dst {
+		if _, ok := tw.h[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, vv := range tw.h {
+		dst[k] = vv
+	}
+	if tw.status != 0 {
+		tw.w.WriteHeader(tw.status)
+	}
+	if tw.buf.Len() > 0 {
+		if _, werr := tw.w.Write(tw.buf.Bytes()); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+package pico
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-laeo/pi"
+)
+
+func TestTimeout(t *testing.T) {
+	late := make(chan error, 1)
+
+	sm := pi.NewServerMux()
+	sm.Use(TimeoutWith(TimeoutOptions{
+		Timeout: 20 * time.Millisecond,
+		Routes:  map[string]time.Duration{"/slow/:id": time.Second},
+	}))
+	sm.Route("/fast").Get(func(ctx pi.Context) error {
+		ctx.Header().Set("x-fast", "1")
+		ctx.Text("fast")
+		if !ctx.Written() || ctx.Status() != http.StatusOK || ctx.Size() != 4 {
+			t.Errorf("want the buffered response reported, got = %v, %d, %d", ctx.Written(), ctx.Status(), ctx.Size())
+		}
+		return nil
+	})
+	sm.Route("/hang").Get(func(ctx pi.Context) error {
+		<-ctx.Context().Done()
+		// races with the error formatter if the outer writer is shared.
+		for i := 0; i < 100; i++ {
+			if ctx.Written() {
+				t.Error("nothing should be written by the late handler")
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		_, err := ctx.Write([]byte("late"))
+		late <- err
+		return nil
+	})
+	sm.Route("/deadline").Get(func(ctx pi.Context) error {
+		ctx.Text("partial")
+		<-ctx.Context().Done()
+		return ctx.Context().Err()
+	})
+	sm.Route("/slow/:id").Get(func(ctx pi.Context) error {
+		time.Sleep(40 * time.Millisecond)
+		return ctx.Text("slow " + ctx.Param("id"))
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		want   string
+	}{
+		{"fast handler should respond", "/fast", 200, "fast"},
+		{"hanging handler should time out", "/hang", 503, "timeout"},
+		{"deadline error should time out", "/deadline", 503, "timeout"},
+		{"route timeout should override", "/slow/1", 200, "slow 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			sm.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.status {
+				t.Fatalf("want status = %d, got = %d", tt.status, w.Code)
+			}
+			if tt.status == 200 {
+				if w.Body.String() != tt.want {
+					t.Fatalf("want body = %s, got = %s", tt.want, w.Body.String())
+				}
+				return
+			}
+
+			result := pi.ErrorResult{}
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("want error result, got = %s", w.Body.String())
+			}
+			if result.Error != tt.want {
+				t.Fatalf("want error = %s, got = %s", tt.want, result.Error)
+			}
+		})
+	}
+
+	if err := <-late; err != http.ErrHandlerTimeout {
+		t.Fatalf("want late write fails with http.ErrHandlerTimeout, got = %v", err)
+	}
+}
+
+func TestTimeout_Panic(t *testing.T) {
+	h := Timeout(time.Second)(func(ctx pi.Context) error {
+		panic("boom")
+	})
+
+	defer func() {
+		if v := recover(); v != "boom" {
+			t.Fatalf("want panic in caller's goroutine, got = %v", v)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
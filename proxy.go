@@ -0,0 +1,190 @@
+package pi
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ProxyHeader is the forwarding header set by the trusted proxies.
+type ProxyHeader int
+
+const (
+	// ProxyXForwardedFor is the de-facto X-Forwarded-For header, with the
+	// X-Forwarded-Proto and X-Forwarded-Host headers. It is the default.
+	ProxyXForwardedFor ProxyHeader = iota
+
+	// ProxyForwarded is the Forwarded header of RFC 7239.
+	ProxyForwarded
+
+	// ProxyXRealIP is the X-Real-IP header, which carries client IP only.
+	ProxyXRealIP
+)
+
+// proxies are the trusted proxies, the forwarding header is only accepted
+// from them.
+type proxies struct {
+	prefixes []netip.Prefix
+	header   ProxyHeader
+}
+
+// parseProxies parses CIDRs or IPs, eg. 10.0.0.0/8 or 192.168.1.1.
+func parseProxies(cidrs []string) ([]netip.Prefix, error) {
+	ps := make([]netip.Prefix, 0, len(cidrs))
+	for _, s := range cidrs {
+		if strings.IndexByte(s, '/') < 0 {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("pi: invalid trusted proxy %s: %w", s, err)
+			}
+			ps = append(ps, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("pi: invalid trusted proxy %s: %w", s, err)
+		}
+		ps = append(ps, p.Masked())
+	}
+	return ps, nil
+}
+
+func (ps *proxies) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range ps.prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// hop is a client or proxy the request passed through, proto and host
+// are the ones of the request received from it.
+type hop struct {
+	addr  netip.Addr // invalid if the address is unknown or obfuscated.
+	proto string
+	host  string
+}
+
+// forwarding resolves the hops of r from the right, the remote address
+// comes first, then the forwarded addresses until the first untrusted
+// one, which is the client. The forwarding header is only accepted if
+// the remote address is trusted, and the other ones are ignored since
+// they may be sent by the client and passed through by the proxies.
+func (ps *proxies) forwarding(r *http.Request) []hop {
+	remote := hop{addr: parseAddr(r.RemoteAddr), host: r.Host, proto: "http"}
+	if r.TLS != nil {
+		remote.proto = "https"
+	}
+	hops := []hop{remote}
+	if !remote.addr.IsValid() || !ps.trusted(remote.addr) {
+		return hops
+	}
+
+	var forwarded []hop
+	switch ps.header {
+	case ProxyForwarded:
+		forwarded = forwardedHops(r.Header)
+	case ProxyXRealIP:
+		if v := r.Header.Get("X-Real-IP"); v != "" {
+			forwarded = []hop{{addr: parseAddr(strings.TrimSpace(v))}}
+		}
+	default:
+		forwarded = xForwardedHops(r.Header)
+		// the proto and host are set by the nearest proxy, which may
+		// forward them without X-Forwarded-For.
+		nearest := &hops[0]
+		if len(forwarded) > 0 {
+			nearest = &forwarded[len(forwarded)-1]
+		}
+		if v := lastValue(r.Header, "X-Forwarded-Proto"); v != "" {
+			nearest.proto = strings.ToLower(v)
+		}
+		if v := lastValue(r.Header, "X-Forwarded-Host"); v != "" {
+			nearest.host = v
+		}
+	}
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		h := forwarded[i]
+		if !h.addr.IsValid() {
+			break
+		}
+		hops = append(hops, h)
+		if !ps.trusted(h.addr) {
+			break
+		}
+	}
+	return hops
+}
+
+// forwardedHops parses the Forwarded header of RFC 7239.
+func forwardedHops(h http.Header) []hop {
+	vv := h.Values("Forwarded")
+	if len(vv) == 0 {
+		return nil
+	}
+
+	var hops []hop
+	for _, element := range strings.Split(strings.Join(vv, ","), ",") {
+		hop := hop{}
+		for _, pair := range strings.Split(element, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(pair), "=")
+			v = strings.Trim(v, `"`)
+			switch strings.ToLower(k) {
+			case "for":
+				hop.addr = parseAddr(v)
+			case "proto":
+				hop.proto = strings.ToLower(v)
+			case "host":
+				hop.host = v
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// xForwardedHops parses the addresses of X-Forwarded-For header.
+func xForwardedHops(h http.Header) []hop {
+	vv := h.Values("X-Forwarded-For")
+	if len(vv) == 0 {
+		return nil
+	}
+
+	var hops []hop
+	for _, v := range strings.Split(strings.Join(vv, ","), ",") {
+		hops = append(hops, hop{addr: parseAddr(strings.TrimSpace(v))})
+	}
+	return hops
+}
+
+// parseAddr parses IP with optional port, eg. 1.2.3.4:80 or [::1]:80,
+// an invalid netip.Addr is returned for unknown or obfuscated ones.
+func parseAddr(s string) netip.Addr {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(s, "[]"))
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// lastValue returns the rightmost value of the comma separated header.
+func lastValue(h http.Header, key string) string {
+	vv := h.Values(key)
+	if len(vv) == 0 {
+		return ""
+	}
+	v := vv[len(vv)-1]
+	if i := strings.LastIndexByte(v, ','); i >= 0 {
+		v = v[i+1:]
+	}
+	return strings.TrimSpace(v)
+}
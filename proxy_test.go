@@ -0,0 +1,148 @@
+package pi
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContext_TrustedProxies(t *testing.T) {
+	type result struct {
+		ip     string
+		ipSet  string
+		scheme string
+		domain string
+	}
+
+	tests := []struct {
+		name    string
+		proxies []string
+		header  ProxyHeader
+		remote  string
+		tls     bool
+		headers map[string]string
+		want    result
+	}{
+		{
+			name:    "headers should be ignored without trusted proxies",
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "1.1.1.1", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "a.com"},
+			want:    result{"10.0.0.1", "10.0.0.1", "http", "example.com"},
+		},
+		{
+			name:    "headers should be ignored from untrusted remote",
+			proxies: []string{"10.0.0.0/8"},
+			remote:  "2.2.2.2:1234",
+			tls:     true,
+			headers: map[string]string{"X-Forwarded-For": "1.1.1.1", "X-Forwarded-Proto": "http"},
+			want:    result{"2.2.2.2", "2.2.2.2", "https", "example.com"},
+		},
+		{
+			name:    "X-Forwarded-For should be parsed from the right",
+			proxies: []string{"10.0.0.0/8", "192.168.1.1"},
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "6.6.6.6, 1.1.1.1, 192.168.1.1", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "a.com"},
+			want:    result{"1.1.1.1", "1.1.1.1,192.168.1.1,10.0.0.1", "https", "a.com"},
+		},
+		{
+			name:    "spoofed X-Forwarded-Proto should use the rightmost",
+			proxies: []string{"10.0.0.0/8"},
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "1.1.1.1", "X-Forwarded-Proto": "http, https"},
+			want:    result{"1.1.1.1", "1.1.1.1,10.0.0.1", "https", "example.com"},
+		},
+		{
+			name:    "X-Forwarded-For should be ignored by ProxyForwarded",
+			header:  ProxyForwarded,
+			proxies: []string{"10.0.0.0/8", "2001:db8::/32"},
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{
+				"Forwarded":       `for=6.6.6.6;proto=http, for="[2001:db8::1]:4711";proto=https;host=a.com, for=10.0.0.2`,
+				"X-Forwarded-For": "7.7.7.7",
+			},
+			want: result{"6.6.6.6", "6.6.6.6,2001:db8::1,10.0.0.2,10.0.0.1", "http", "a.com"},
+		},
+		{
+			name:    "Forwarded of the client should be used",
+			header:  ProxyForwarded,
+			proxies: []string{"10.0.0.0/8"},
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"Forwarded": `for=1.1.1.1;proto=https;host=a.com, for=10.0.0.2;proto=http;host=internal`},
+			want:    result{"1.1.1.1", "1.1.1.1,10.0.0.2,10.0.0.1", "https", "a.com"},
+		},
+		{
+			name:    "obfuscated Forwarded should stop parsing",
+			header:  ProxyForwarded,
+			proxies: []string{"10.0.0.0/8"},
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"Forwarded": `for=1.1.1.1, for=_hidden`},
+			want:    result{"10.0.0.1", "10.0.0.1", "http", "example.com"},
+		},
+		{
+			name:    "X-Real-IP should be used by ProxyXRealIP",
+			header:  ProxyXRealIP,
+			proxies: []string{"10.0.0.0/8"},
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Real-IP": "1.1.1.1"},
+			want:    result{"1.1.1.1", "1.1.1.1,10.0.0.1", "http", "example.com"},
+		},
+		{
+			name:    "forged Forwarded should be ignored by default",
+			proxies: []string{"10.0.0.0/8"},
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{
+				"Forwarded":       "for=1.2.3.4;proto=https;host=evil.example",
+				"X-Forwarded-For": "203.0.113.7",
+			},
+			want: result{"203.0.113.7", "203.0.113.7,10.0.0.1", "http", "example.com"},
+		},
+		{
+			name:    "forged X-Real-IP should be ignored by default",
+			proxies: []string{"10.0.0.0/8"},
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Real-IP": "1.2.3.4"},
+			want:    result{"10.0.0.1", "10.0.0.1", "http", "example.com"},
+		},
+		{
+			name:    "X-Forwarded-Proto and X-Forwarded-Host should be used without X-Forwarded-For",
+			proxies: []string{"10.0.0.0/8"},
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "a.com"},
+			want:    result{"10.0.0.1", "10.0.0.1", "https", "a.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got result
+			sm := NewServerMux(WithTrustedProxies(tt.proxies...), WithProxyHeader(tt.header))
+			sm.Route("/").Get(func(ctx Context) error {
+				got = result{ctx.IP(), strings.Join(ctx.IPSet(), ","), ctx.Scheme(), ctx.Domain()}
+				return nil
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			sm.ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.want {
+				t.Fatalf("want = %+v, got = %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWithTrustedProxies(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("invalid proxy should panic")
+		}
+	}()
+	WithTrustedProxies("10.0.0.0/33")
+}
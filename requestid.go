@@ -0,0 +1,17 @@
+package pi
+
+import "context"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of parent which carries the request ID id.
+func WithRequestID(parent context.Context, id string) context.Context {
+	return context.WithValue(parent, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, eg. the one set by
+// pico.RequestID, or empty string if not available.
+func RequestID(ctx Context) string {
+	id, _ := ctx.Context().Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,57 @@
+package pi
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseWriter(t *testing.T) {
+	t.Run("status and size should be recorded", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ctx := createContext(w, httptest.NewRequest(http.MethodGet, "/", nil), nil)
+		if ctx.Written() || ctx.Status() != 0 {
+			t.Fatal("nothing should be written")
+		}
+		ctx.Text("hello")
+		if !ctx.Written() || ctx.Status() != http.StatusOK || ctx.Size() != 5 {
+			t.Fatalf("want 200 and 5 bytes written, got = %d, %d", ctx.Status(), ctx.Size())
+		}
+	})
+
+	t.Run("superfluous WriteHeader should be ignored", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ctx := createContext(w, httptest.NewRequest(http.MethodGet, "/", nil), nil)
+		ctx.Code(http.StatusCreated)
+		ctx.Code(http.StatusInternalServerError)
+		if ctx.Status() != http.StatusCreated || w.Code != http.StatusCreated {
+			t.Fatalf("want status = 201, got = %d, %d", ctx.Status(), w.Code)
+		}
+	})
+
+	t.Run("optional interfaces should be passed through", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ctx := createContext(w, httptest.NewRequest(http.MethodGet, "/", nil), nil)
+		rw, _ := ctx.Raw()
+
+		n, err := rw.(io.ReaderFrom).ReadFrom(strings.NewReader("hello"))
+		if err != nil || n != 5 || ctx.Size() != 5 || w.Body.String() != "hello" {
+			t.Fatalf("want 5 bytes read from, got = %d, %v", n, err)
+		}
+
+		rw.(http.Flusher).Flush()
+		if !w.Flushed {
+			t.Fatal("underlying writer should be flushed")
+		}
+
+		if _, _, err := rw.(http.Hijacker).Hijack(); !errors.Is(err, http.ErrNotSupported) {
+			t.Fatalf("want http.ErrNotSupported, got = %v", err)
+		}
+		if err := http.NewResponseController(rw).Flush(); err != nil {
+			t.Fatalf("ResponseController should find the underlying writer, got = %v", err)
+		}
+	})
+}
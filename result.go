@@ -7,6 +7,8 @@ type Result[T any] struct {
 type ErrorResult struct {
 	Error        string `json:"error"`
 	ErrorMessage string `json:"error_message"`
+	Details      any    `json:"details,omitempty"`
+	RequestID    string `json:"request_id,omitempty"`
 }
 
 type LengthResult[T any] struct {
@@ -1,10 +1,14 @@
 package pi
 
 import (
+	"fmt"
+	"log"
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
 	"strings"
+	"sync"
 )
 
 const (
@@ -25,152 +29,392 @@ type Route interface {
 	Options(h HandlerFunc) Route
 	Head(h HandlerFunc) Route
 	Any(h HandlerFunc) Route
+
+	// Name names the route for URL generation by (ServerMux).URL(),
+	// it panics if name is already used by another route.
+	Name(name string) Route
+
+	// Use applies middleware to all methods of the route, including
+	// the ones registered before calling Use.
+	Use(cc ...func(next HandlerFunc) HandlerFunc) Route
+}
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	// Host is the host pattern the route registered by (ServerMux).Host(),
+	// empty for the routes of default host.
+	Host string
+
+	// Pattern is the path pattern the route registered by, eg. /users/:id.
+	Pattern string
+
+	// Methods are sorted HTTP methods which have registered handler,
+	// "*" stands for the handler registered by (Route).Any().
+	Methods []string
+
+	// Name is the name set by (Route).Name().
+	Name string
+
+	// Middlewares is the count of middleware applied to the route.
+	Middlewares int
 }
 
 var _ Route = (*_route)(nil)
 
+// endpoint is a handler registered by user, with the middleware of the
+// group where it was registered.
+type endpoint struct {
+	h  HandlerFunc
+	cc []func(HandlerFunc) HandlerFunc
+}
+
+// _route is a segment of the registered path patterns, the tree of _route
+// keeps what were registered and is indexed by a radix tree for looking up.
 type _route struct {
 	parent           *_route
-	sub              map[string]*_route
-	hmap             map[string]HandlerFunc
+	sub              map[string]*_route // static children.
+	dynamics         []*_route          // dynamic children, constrained ones go first.
+	wildcard         *_route
+	hmap             map[string]HandlerFunc // handlers with middleware applied.
+	raw              map[string]endpoint
+	preflight        HandlerFunc // handles OPTIONS request automatically.
 	pattern          string
+	full             string // the pattern registered by, only available on routes have handlers.
 	placeholder      string
-	cc               []func(HandlerFunc) HandlerFunc
+	constraint       Constraint
+	expr             string // constraint expression, eg. int of :id<int>.
+	name             string
+	names            map[string]*_route              // only available on root route.
+	shapes           map[string]*_route              // only available on root route.
+	index            *node                           // radix tree for looking up, only available on root route.
+	constraints      map[string]Constraint           // only available on root route.
+	cc               []func(HandlerFunc) HandlerFunc // the group middleware, or the mux-level middleware on root route.
+	use              []func(HandlerFunc) HandlerFunc // the middleware applied by (Route).Use().
+	scope            *scope                          // the scope registered in.
+	mu               sync.Mutex                      // only available on root route.
+	strict           bool                            // only available on root route.
+	slash            bool                            // trailing slash is significant, only available on root route.
+	main             *_route                         // the root route of default tree, only available on root route of host trees.
+	host             string                          // host pattern, only available on root route of host trees.
 	hasDynamicChild  bool
 	hasWildcardChild bool
 }
 
 func createRootRoute() *_route {
-	return &_route{}
+	return &_route{
+		constraints: make(map[string]Constraint),
+	}
 }
 
 func (p *_route) Search(route string, captured url.Values) Route {
-	route = path.Clean(route)
-	chunks := strings.Split(route, "/")
+	ps := paramsPool.Get().(*Params)
+	defer paramsPool.Put(ps)
 
-	current := p
-SEARCH:
-	for i := 0; i < len(chunks); i++ {
-		seg := chunks[i]
+	ps.truncate(0)
+	n := p.lookup(path.Clean(route), ps)
+	if n == nil {
+		return nil
+	}
+	for _, p := range *ps {
+		captured.Add(p.Key, p.Value)
+	}
+	return n
+}
 
-		next, ok := current.sub[seg]
-		if ok {
-			current = next
-			continue
-		}
+// lookup finds the route matches route, which should be cleaned according
+// to the path policy, the captured params are appended to ps.
+func (p *_route) lookup(route string, ps *Params) *_route {
+	if p.index == nil {
+		return nil
+	}
+	return p.index.lookup(route, ps)
+}
 
-		if current.hasDynamicChild {
-			next, ok = current.sub[string(dynamic)]
-			if ok {
-				captured.Add(next.placeholder, seg)
-				current = next // continues on dynamic route.
-				continue
-			}
+// searchFold is like lookup but matches static routes case-insensitively,
+// it returns the matched path in canonical case, or nil if not found.
+func (p *_route) searchFold(chunks []string, fixed []string) []string {
+	if len(chunks) == 0 {
+		if len(p.hmap) > 0 {
+			return fixed
 		}
+		return nil
+	}
 
-		if current.hasWildcardChild {
-			next, ok = current.sub[string(wildcard)]
-			if ok {
-				captured.Add(next.placeholder, strings.Join(chunks[i:], "/"))
-				// wildcard route should returns immediately.
-				return next
+	seg := chunks[0]
+	if next, ok := p.sub[seg]; ok {
+		if f := next.searchFold(chunks[1:], append(fixed, seg)); f != nil {
+			return f
+		}
+	}
+	for k, next := range p.sub {
+		if k != seg && strings.EqualFold(k, seg) {
+			if f := next.searchFold(chunks[1:], append(fixed, k)); f != nil {
+				return f
 			}
 		}
+	}
 
-		for current.parent != nil {
-			if current.parent.hasDynamicChild {
-				k := string(dynamic)
-				next = current.parent.sub[k]
-				if next != current {
-					i--
-					captured.Add(next.placeholder, chunks[i])
-					current = next
-					continue SEARCH
-				}
+	if seg != "" {
+		for _, next := range p.dynamics {
+			if next.constraint != nil && !next.constraint(seg) {
+				continue
 			}
-			if current.parent.hasWildcardChild {
-				k := string(wildcard)
-				next = current.parent.sub[k]
-				if next != current {
-					i--
-					captured.Add(next.placeholder, strings.Join(chunks[i:], "/"))
-					return next
-				}
+			if f := next.searchFold(chunks[1:], append(fixed, seg)); f != nil {
+				return f
 			}
+		}
+	}
+
+	if p.wildcard != nil && len(p.wildcard.hmap) > 0 {
+		return append(fixed, chunks...)
+	}
+
+	return nil
+}
+
+func (p *_route) Insert(route string) *_route {
+	return p.insert(route, nil)
+}
+
+// insert is like Insert but registers route in scope s, the route can
+// only be registered in one scope.
+func (p *_route) insert(route string, s *scope) *_route {
+	top := p.top()
+	top.mu.Lock()
+	defer top.mu.Unlock()
+
+	if top.slash {
+		route = cleanPath(route)
+	} else {
+		route = path.Clean(route)
+	}
+	chunks := strings.Split(route, "/")
+	current := p
+	for i, seg := range chunks {
+		if len(seg) > 0 && seg[0] == wildcard && i < len(chunks)-1 {
+			panic(fmt.Sprintf("pi: wildcard %s must be the last segment of %s", seg, route))
+		}
+		current = current.child(seg)
+	}
 
-			i--
-			current = current.parent
+	if current.hmap == nil {
+		current.hmap = make(map[string]HandlerFunc)
+		current.full = current.fullPattern()
+
+		// the routes only differ in param names are ambiguous, the latter
+		// one will never be reached.
+		root := p.root()
+		if root.shapes == nil {
+			root.shapes = make(map[string]*_route)
 		}
+		shape := current.shape()
+		if prev, ok := root.shapes[shape]; ok {
+			panic(fmt.Sprintf("pi: route %s conflicts with %s", current.fullPattern(), prev.fullPattern()))
+		}
+		root.shapes[shape] = current
 
-		return nil
+		if root.index == nil {
+			root.index = &node{}
+		}
+		root.index.insert(current)
+	}
+
+	if len(current.hmap) > 0 && current.scope != s {
+		current.conflict(fmt.Errorf("%w: %s is registered with different middleware", ErrMiddlewareMismatch, current.fullPattern()))
 	}
 
+	current.scope = s
+	current.cc = s.middleware()
+
 	return current
 }
 
-func (p *_route) Insert(route string, cc ...func(HandlerFunc) HandlerFunc) *_route {
-	route = path.Clean(route)
-	current := p
-	for _, seg := range strings.Split(route, "/") {
-		if current.sub == nil {
-			current.sub = make(map[string]*_route)
+// conflict reports a conflicting registration, it panics in strict mode,
+// otherwise logs a warning.
+func (p *_route) conflict(err error) {
+	if p.top().strict {
+		panic(err)
+	}
+	log.Printf("pi: warning: %v", err)
+}
+
+// child finds or creates the child route of p by seg.
+func (p *_route) child(seg string) *_route {
+	if len(seg) > 0 && seg[0] == wildcard {
+		if p.wildcard != nil && p.wildcard.pattern != seg {
+			panic(fmt.Sprintf("pi: wildcard %s conflicts with %s", seg, p.wildcard.fullPattern()))
+		}
+		if p.wildcard == nil {
+			p.hasWildcardChild = true
+			p.wildcard = &_route{
+				parent:      p,
+				pattern:     seg,
+				placeholder: seg[1:],
+			}
 		}
+		return p.wildcard
+	}
 
-		next, ok := current.sub[seg]
-		if ok {
-			current = next
-			continue
+	if len(seg) > 0 && seg[0] == dynamic {
+		placeholder, expr := parseParam(seg)
+
+		// the dynamic routes with different param names are different
+		// branches, they are tried in order during searching.
+		for _, next := range p.dynamics {
+			if next.pattern == seg {
+				return next
+			}
 		}
 
-		next = &_route{
-			parent:      current,
+		next := &_route{
+			parent:      p,
 			pattern:     seg,
-			placeholder: seg,
+			placeholder: placeholder,
+			expr:        expr,
 		}
-
-		if len(seg) > 0 {
-			switch next.pattern[0] {
-			case dynamic:
-				current.hasDynamicChild = true
-				next.placeholder = next.placeholder[1:]
-				current.sub[string(dynamic)] = next
-			case wildcard:
-				current.hasWildcardChild = true
-				next.placeholder = next.placeholder[1:]
-				current.sub[string(wildcard)] = next
+		if expr != "" {
+			c, err := parseConstraint(p.top().constraints, expr)
+			if err != nil {
+				panic(err)
 			}
+			next.constraint = c
 		}
 
-		current.sub[seg] = next
-		current = next
+		p.hasDynamicChild = true
+		p.dynamics = append(p.dynamics, next)
+		// constrained routes should be tried before unconstrained one.
+		sort.SliceStable(p.dynamics, func(i, j int) bool {
+			return p.dynamics[i].expr != "" && p.dynamics[j].expr == ""
+		})
+		return next
 	}
 
-	if current.hmap == nil {
-		current.hmap = make(map[string]HandlerFunc)
+	if p.sub == nil {
+		p.sub = make(map[string]*_route)
 	}
-
-	current.cc = cc
-
-	return current
+	next, ok := p.sub[seg]
+	if !ok {
+		next = &_route{
+			parent:      p,
+			pattern:     seg,
+			placeholder: seg,
+		}
+		p.sub[seg] = next
+	}
+	return next
 }
 
 func (p *_route) Invoke(ctx Context) error {
-	fn, ok := p.hmap[ctx.Method()]
+	method := ctx.Method()
+	fn, ok := p.hmap[method]
+	if !ok && method == http.MethodHead {
+		// answers HEAD by GET handler if HEAD handler is not registered.
+		if fn, ok = p.hmap[http.MethodGet]; ok {
+			return serveHead(ctx, fn)
+		}
+	}
 	if !ok {
 		fn, ok = p.hmap[anyone]
 	}
 	if !ok {
-		return ErrHandlerNotFound
+		if len(p.hmap) == 0 {
+			return ErrHandlerNotFound
+		}
+
+		ctx.Header().Set("Allow", strings.Join(p.allow(), ", "))
+		if method == http.MethodOptions {
+			return p.preflight(ctx)
+		}
+		return ErrMethodNotAllowed
 	}
 
 	return fn(ctx)
 }
 
+// methods returns sorted HTTP methods which have registered handler.
+func (p *_route) methods() []string {
+	mm := make([]string, 0, len(p.hmap))
+	for m := range p.hmap {
+		mm = append(mm, m)
+	}
+	sort.Strings(mm)
+	return mm
+}
+
+// allow returns sorted HTTP methods which are acceptable by p, including
+// the HEAD and OPTIONS methods which are handled automatically.
+func (p *_route) allow() []string {
+	mm := p.methods()
+	if _, ok := p.hmap[http.MethodGet]; ok {
+		if _, ok := p.hmap[http.MethodHead]; !ok {
+			mm = append(mm, http.MethodHead)
+		}
+	}
+	if _, ok := p.hmap[http.MethodOptions]; !ok {
+		mm = append(mm, http.MethodOptions)
+	}
+	sort.Strings(mm)
+	return mm
+}
+
 func (p *_route) For(method string, h HandlerFunc) Route {
-	p.hmap[method] = h.Connect(p.cc...)
+	top := p.top()
+	top.mu.Lock()
+	defer top.mu.Unlock()
+
+	if _, ok := p.hmap[method]; ok {
+		p.conflict(fmt.Errorf("%w: %s %s is already registered", ErrDuplicateRoute, method, p.fullPattern()))
+	}
+	if p.raw == nil {
+		p.raw = make(map[string]endpoint)
+	}
+	p.raw[method] = endpoint{h: h, cc: p.cc}
+	p.compile(top.cc)
 	return p
 }
 
+func (p *_route) Use(cc ...func(next HandlerFunc) HandlerFunc) Route {
+	top := p.top()
+	top.mu.Lock()
+	defer top.mu.Unlock()
+
+	p.use = append(p.use, cc...)
+	p.compile(top.cc)
+	return p
+}
+
+// compile applies the mux-level middleware global, the group middleware
+// and the route middleware to the registered handlers of p.
+func (p *_route) compile(global []func(HandlerFunc) HandlerFunc) {
+	chain := func(cc []func(HandlerFunc) HandlerFunc) []func(HandlerFunc) HandlerFunc {
+		all := make([]func(HandlerFunc) HandlerFunc, 0, len(global)+len(cc)+len(p.use))
+		all = append(all, global...)
+		all = append(all, cc...)
+		return append(all, p.use...)
+	}
+
+	for method, ep := range p.raw {
+		p.hmap[method] = ep.h.Connect(chain(ep.cc)...)
+	}
+	p.preflight = defaultOptionsHandler.Connect(chain(p.cc)...)
+}
+
+// compileAll re-applies middleware to p and all of its descendants.
+func (p *_route) compileAll(global []func(HandlerFunc) HandlerFunc) {
+	if len(p.raw) > 0 {
+		p.compile(global)
+	}
+	for _, next := range p.sub {
+		next.compileAll(global)
+	}
+	for _, next := range p.dynamics {
+		next.compileAll(global)
+	}
+	if p.wildcard != nil {
+		p.wildcard.compileAll(global)
+	}
+}
+
 func (p *_route) Get(h HandlerFunc) Route {
 	return p.For(http.MethodGet, h)
 }
@@ -202,3 +446,152 @@ func (p *_route) Head(h HandlerFunc) Route {
 func (p *_route) Any(h HandlerFunc) Route {
 	return p.For(string(wildcard), h)
 }
+
+func (p *_route) Name(name string) Route {
+	top := p.top()
+	top.mu.Lock()
+	defer top.mu.Unlock()
+
+	if top.names == nil {
+		top.names = make(map[string]*_route)
+	}
+	if prev, ok := top.names[name]; ok && prev != p {
+		panic(fmt.Sprintf("pi: route name %q is already used by %s", name, prev.fullPattern()))
+	}
+	if p.name != "" {
+		delete(top.names, p.name)
+	}
+	p.name = name
+	top.names[name] = p
+	return p
+}
+
+// root returns the root route of the tree p belongs to.
+func (p *_route) root() *_route {
+	current := p
+	for current.parent != nil {
+		current = current.parent
+	}
+	return current
+}
+
+// top returns the root route of the default tree, which holds the
+// settings shared with host trees.
+func (p *_route) top() *_route {
+	root := p.root()
+	if root.main != nil {
+		return root.main
+	}
+	return root
+}
+
+// chain returns routes from the top to p, excluding root route.
+func (p *_route) chain() []*_route {
+	var rr []*_route
+	for current := p; current.parent != nil; current = current.parent {
+		rr = append(rr, current)
+	}
+	for i, j := 0, len(rr)-1; i < j; i, j = i+1, j-1 {
+		rr[i], rr[j] = rr[j], rr[i]
+	}
+	return rr
+}
+
+// fullPattern returns the pattern p registered by, eg. /users/:id.
+func (p *_route) fullPattern() string {
+	chain := p.chain()
+	parts := make([]string, len(chain))
+	for i, r := range chain {
+		parts[i] = r.pattern
+	}
+	return strings.Join(parts, "/")
+}
+
+// shape returns the pattern of p without param names, eg. /users/:<int>
+// for /users/:id<int>.
+func (p *_route) shape() string {
+	chain := p.chain()
+	parts := make([]string, len(chain))
+	for i, r := range chain {
+		switch {
+		case len(r.pattern) == 0:
+		case r.pattern[0] == dynamic:
+			parts[i] = ":<" + r.expr + ">"
+		case r.pattern[0] == wildcard:
+			parts[i] = "*"
+		default:
+			parts[i] = r.pattern
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// build generates URL path of p with params.
+func (p *_route) build(params url.Values) (string, error) {
+	chain := p.chain()
+	parts := make([]string, len(chain))
+	for i, r := range chain {
+		if len(r.pattern) == 0 {
+			continue
+		}
+
+		switch r.pattern[0] {
+		case dynamic, wildcard:
+			v := params.Get(r.placeholder)
+			if v == "" && (r.pattern[0] == dynamic || !params.Has(r.placeholder)) {
+				return "", fmt.Errorf("%w: %s requires %s", ErrMissingParam, p.fullPattern(), r.placeholder)
+			}
+			if r.pattern[0] == dynamic {
+				parts[i] = url.PathEscape(v)
+				continue
+			}
+			segs := strings.Split(v, "/")
+			for j := range segs {
+				segs[j] = url.PathEscape(segs[j])
+			}
+			parts[i] = strings.Join(segs, "/")
+		default:
+			parts[i] = r.pattern
+		}
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// walk calls fn for p and every descendant route which has registered
+// handler in tree order, the static children sorted by segment first,
+// then the params and wildcard.
+func (p *_route) walk(fn func(RouteInfo) error) error {
+	if len(p.hmap) > 0 {
+		err := fn(RouteInfo{
+			Host:        p.root().host,
+			Pattern:     p.fullPattern(),
+			Methods:     p.methods(),
+			Name:        p.name,
+			Middlewares: len(p.top().cc) + len(p.cc) + len(p.use),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(p.sub))
+	for k := range p.sub {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := p.sub[k].walk(fn); err != nil {
+			return err
+		}
+	}
+	for _, next := range p.dynamics {
+		if err := next.walk(fn); err != nil {
+			return err
+		}
+	}
+	if p.wildcard != nil {
+		return p.wildcard.walk(fn)
+	}
+	return nil
+}
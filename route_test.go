@@ -1,9 +1,13 @@
 package pi
 
 import (
+	"errors"
+	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"testing"
 )
 
@@ -155,6 +159,10 @@ func TestRouteSpecialInsert(t *testing.T) {
 }
 
 func BenchmarkNodeInsert(b *testing.B) {
+	// duplicate registrations are expected here, drop the warnings.
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
 	root := &_route{
 		sub: make(map[string]*_route),
 	}
@@ -247,7 +255,7 @@ func TestRouteSearch(t *testing.T) {
 			}
 			w := httptest.NewRecorder()
 			r := httptest.NewRequest(http.MethodGet, tt.args.route, nil)
-			err := got.Invoke(createContext(w, r, captured))
+			err := got.Invoke(createContext(w, r, nil))
 			if err != nil {
 				t.Fatalf("[%s] does not define http.Handler: %s", tt.name, err)
 			}
@@ -267,6 +275,10 @@ func TestRouteSearch(t *testing.T) {
 }
 
 func BenchmarkRouteSearch(b *testing.B) {
+	// duplicate registrations are expected here, drop the warnings.
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
 	gen := func(b string) HandlerFunc {
 		return func(ctx Context) error {
 			return ctx.Text(b)
@@ -293,3 +305,178 @@ func BenchmarkRouteSearch(b *testing.B) {
 		root.Search("/api/v1/users/100/posts/101", cap)
 	}
 }
+
+func TestRouteName(t *testing.T) {
+	sm := NewServerMux()
+	sm.Route("/users/:id/posts/*rest").Get(nil).Name("user.posts")
+	sm.Route("/users/:id").Get(nil).Name("user")
+	sm.Group("/api/v1", func(sm ServerMux) {
+		sm.Route("/status").Get(nil).Name("status")
+	})
+
+	tests := []struct {
+		name    string
+		route   string
+		params  []string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "build static route should succeed",
+			route: "status",
+			want:  "/api/v1/status",
+		},
+		{
+			name:   "build dynamic route should succeed",
+			route:  "user",
+			params: []string{"id", "1"},
+			want:   "/users/1",
+		},
+		{
+			name:   "params should be escaped",
+			route:  "user",
+			params: []string{"id", "a b/c"},
+			want:   "/users/a%20b%2Fc",
+		},
+		{
+			name:   "wildcard param should keep slashes",
+			route:  "user.posts",
+			params: []string{"id", "1", "rest", "2022/hello world"},
+			want:   "/users/1/posts/2022/hello%20world",
+		},
+		{
+			name:    "missing param should fail",
+			route:   "user.posts",
+			params:  []string{"id", "1"},
+			wantErr: ErrMissingParam,
+		},
+		{
+			name:    "unknown name should fail",
+			route:   "unknown",
+			wantErr: ErrRouteNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sm.URL(tt.route, tt.params...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error want = %v, got = %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Fatalf("URL want = %s, got = %s", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("duplicated name should panic", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("register duplicated name should panic")
+			}
+		}()
+		sm.Route("/posts").Get(nil).Name("user")
+	})
+}
+
+func TestRouteDynamicBranches(t *testing.T) {
+	gen := func(b string, params ...string) HandlerFunc {
+		return func(ctx Context) error {
+			for _, p := range params {
+				b += " " + p + "=" + ctx.Param(p)
+			}
+			return ctx.Text(b)
+		}
+	}
+
+	sm := NewServerMux()
+	sm.Route("/users/:id").Get(gen("user", "id"))
+	sm.Route("/users/:name/profile").Get(gen("profile", "name", "id"))
+	sm.Route("/users/:name/posts/:id").Get(gen("post", "name", "id"))
+
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{
+			name:   "first branch should capture its own param",
+			target: "/users/1",
+			want:   "user id=1",
+		},
+		{
+			name:   "second branch should capture its own param",
+			target: "/users/alice/profile",
+			want:   "profile name=alice id=",
+		},
+		{
+			name:   "nested params in second branch should succeed",
+			target: "/users/alice/posts/2",
+			want:   "post name=alice id=2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			sm.ServeHTTP(w, r)
+			if w.Body.String() != tt.want {
+				t.Fatalf("body want = %s, got = %s", tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouteInsertConflict(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes []string
+		panics bool
+	}{
+		{
+			name:   "routes only differ in param names should panic",
+			routes: []string{"/users/:id", "/users/:name"},
+			panics: true,
+		},
+		{
+			name:   "nested routes only differ in param names should panic",
+			routes: []string{"/users/:id/posts/:po", "/users/:uid/posts/:pid"},
+			panics: true,
+		},
+		{
+			name:   "wildcards with different names should panic",
+			routes: []string{"/files/*path", "/files/*rest"},
+			panics: true,
+		},
+		{
+			name:   "wildcard not at the end should panic",
+			routes: []string{"/files/*path/meta"},
+			panics: true,
+		},
+		{
+			name:   "routes with different constraints should not panic",
+			routes: []string{"/users/:id<int>", "/users/:name"},
+		},
+		{
+			name:   "routes with different shapes should not panic",
+			routes: []string{"/users/:id", "/users/:name/profile"},
+		},
+		{
+			name:   "same route registered twice should not panic",
+			routes: []string{"/users/:id", "/users/:id"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); (r != nil) != tt.panics {
+					t.Fatalf("panics want = %v, got = %v", tt.panics, r)
+				}
+			}()
+
+			root := createRootRoute()
+			for _, route := range tt.routes {
+				root.Insert(route).Get(nil)
+			}
+		})
+	}
+}
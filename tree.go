@@ -0,0 +1,174 @@
+package pi
+
+import (
+	"sort"
+	"strings"
+)
+
+// node is a node of the compressed radix tree which indexes the routes
+// for looking up. The static parts of patterns are compressed across
+// segments, eg. /api/v1/users/ is a single node if nothing branches from
+// its middle, while params and wildcards always take a whole segment.
+type node struct {
+	prefix   string  // static prefix matched by the node.
+	indices  string  // the first bytes of static children.
+	statics  []*node // static children.
+	params   []*node // param children, constrained ones go first.
+	wildcard *node
+
+	key        string // param name, only available on param and wildcard nodes.
+	pattern    string // eg. :id<int>, only available on param and wildcard nodes.
+	constraint Constraint
+
+	route *_route // the route ends at this node.
+}
+
+// insert indexes route r by its segments.
+func (n *node) insert(r *_route) {
+	current := n
+	static := ""
+	for i, seg := range r.chain() {
+		if i > 0 {
+			static += "/"
+		}
+
+		switch {
+		case len(seg.pattern) > 0 && seg.pattern[0] == dynamic:
+			current = current.insertStatic(static).paramChild(seg)
+			static = ""
+		case len(seg.pattern) > 0 && seg.pattern[0] == wildcard:
+			current = current.insertStatic(static).wildcardChild(seg)
+			static = ""
+		default:
+			static += seg.pattern
+		}
+	}
+	current.insertStatic(static).route = r
+}
+
+// insertStatic finds or creates the node matches n's prefix followed by
+// s, splits the existing nodes if necessary.
+func (n *node) insertStatic(s string) *node {
+	current := n
+	for len(s) > 0 {
+		i := strings.IndexByte(current.indices, s[0])
+		if i < 0 {
+			child := &node{prefix: s}
+			current.indices += s[:1]
+			current.statics = append(current.statics, child)
+			return child
+		}
+
+		child := current.statics[i]
+		l := commonPrefix(child.prefix, s)
+		if l < len(child.prefix) {
+			split := &node{
+				prefix:  child.prefix[:l],
+				indices: child.prefix[l : l+1],
+				statics: []*node{child},
+			}
+			child.prefix = child.prefix[l:]
+			current.statics[i] = split
+			child = split
+		}
+
+		current = child
+		s = s[l:]
+	}
+	return current
+}
+
+func (n *node) paramChild(seg *_route) *node {
+	for _, child := range n.params {
+		if child.pattern == seg.pattern {
+			return child
+		}
+	}
+
+	child := &node{
+		key:        seg.placeholder,
+		pattern:    seg.pattern,
+		constraint: seg.constraint,
+	}
+	n.params = append(n.params, child)
+	// constrained params should be tried before unconstrained one.
+	sort.SliceStable(n.params, func(i, j int) bool {
+		return n.params[i].constraint != nil && n.params[j].constraint == nil
+	})
+	return child
+}
+
+func (n *node) wildcardChild(seg *_route) *node {
+	if n.wildcard == nil {
+		n.wildcard = &node{
+			key:     seg.placeholder,
+			pattern: seg.pattern,
+		}
+	}
+	return n.wildcard
+}
+
+// lookup finds the route matches path, which is the rest of request path
+// after n's prefix. Static children are tried first, then params and the
+// wildcard, it backtracks to the next candidate if a branch does not
+// match. The captured params are appended to ps.
+func (n *node) lookup(path string, ps *Params) *_route {
+	if len(path) == 0 {
+		if n.route != nil && len(n.route.hmap) > 0 {
+			return n.route
+		}
+	} else if i := strings.IndexByte(n.indices, path[0]); i >= 0 {
+		child := n.statics[i]
+		if strings.HasPrefix(path, child.prefix) {
+			if r := child.lookup(path[len(child.prefix):], ps); r != nil {
+				return r
+			}
+		}
+	}
+
+	if len(n.params) > 0 {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if seg := path[:end]; seg != "" {
+			mark := len(*ps)
+			for _, child := range n.params {
+				if child.constraint != nil && !child.constraint(seg) {
+					continue
+				}
+
+				ps.add(child.key, seg)
+				if r := child.lookup(path[end:], ps); r != nil {
+					return r
+				}
+				ps.truncate(mark)
+			}
+		}
+	}
+
+	if n.wildcard != nil && n.wildcard.route != nil && len(n.wildcard.route.hmap) > 0 {
+		// wildcard captures all the rest of path.
+		ps.add(n.wildcard.key, path)
+		return n.wildcard.route
+	}
+
+	return nil
+}
+
+// parseParam splits param segment to name and constraint expression, eg.
+// :id<int> to id and int.
+func parseParam(seg string) (name, expr string) {
+	if i := strings.IndexByte(seg, '<'); i > 0 && seg[len(seg)-1] == '>' {
+		return seg[1:i], seg[i+1 : len(seg)-1]
+	}
+	return seg[1:], ""
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}